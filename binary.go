@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// binaryMagic starts every binary snapshot, followed by binaryVersion
+const (
+	binaryMagic   = "CHSH"
+	binaryVersion = 1
+)
+
+// IsBinarySnapshot reports whether data starts like a snapshot written by MarshalBinary
+func IsBinarySnapshot(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(binaryMagic))
+}
+
+// binaryWriter appends length-prefixed fields to a buffer
+type binaryWriter struct {
+	bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+// uvarint appends an unsigned integer
+func (w *binaryWriter) uvarint(n uint64) {
+	w.Write(w.scratch[:binary.PutUvarint(w.scratch[:], n)])
+}
+
+// bytes appends a length-prefixed byte slice
+func (w *binaryWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.Write(b)
+}
+
+// MarshalBinary encodes all groups into a compact binary snapshot that
+// RestoreBinary accepts. Groups and elements are written in sorted order,
+// so equal registries produce equal snapshots.
+//
+// The layout is the magic "CHSH", a version byte and the number of groups,
+// then for each group its name, replicas and number of elements, and for each
+// element its key and payload. Numbers are uvarints and strings are prefixed
+// with their length as a uvarint.
+func (c *CHash) MarshalBinary() ([]byte, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	w := &binaryWriter{}
+	w.WriteString(binaryMagic)
+	w.WriteByte(binaryVersion)
+	w.uvarint(uint64(len(c.groups)))
+	for _, name := range sortedNames(c.groups) {
+		group := c.groups[name]
+		group.RLock()
+		keys := make([]string, 0, len(group.Elements))
+		for key := range group.Elements {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		w.bytes([]byte(group.Name))
+		w.uvarint(uint64(group.NumberOfReplicas))
+		w.uvarint(uint64(len(keys)))
+		for _, key := range keys {
+			w.bytes([]byte(key))
+			w.bytes(group.Elements[key].Payload)
+		}
+		group.RUnlock()
+	}
+	return w.Bytes(), nil
+}
+
+// binaryReader consumes length-prefixed fields, remembering the first error
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+// uvarint consumes an unsigned integer
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(r.data)
+	if size <= 0 {
+		r.err = ErrInvalidSnapshot
+		return 0
+	}
+	r.data = r.data[size:]
+	return n
+}
+
+// count consumes a number of items that each take at least one byte,
+// so a corrupt count cannot cause a large allocation
+func (r *binaryReader) count() int {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(r.data)) {
+		r.err = ErrInvalidSnapshot
+	}
+	if r.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// bytes consumes a length-prefixed byte slice, an empty one is returned as nil
+func (r *binaryReader) bytes() []byte {
+	n := r.count()
+	if r.err != nil || n == 0 {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data)
+	r.data = r.data[n:]
+	return b
+}
+
+// decodeBinary decodes a binary snapshot into a new set of groups
+func decodeBinary(data []byte) (map[string]*Group, error) {
+	if !IsBinarySnapshot(data) || len(data) < len(binaryMagic)+1 || data[len(binaryMagic)] != binaryVersion {
+		return nil, ErrInvalidSnapshot
+	}
+	r := &binaryReader{data: data[len(binaryMagic)+1:]}
+	groups := make(map[string]*Group)
+	for i, n := 0, r.count(); i < n && r.err == nil; i++ {
+		name := string(r.bytes())
+		replicas := r.uvarint()
+		if replicas > math.MaxInt32 {
+			return nil, ErrInvalidReplicas
+		}
+		group := NewGroup(name, int(replicas))
+		for j, m := 0, r.count(); j < m && r.err == nil; j++ {
+			key := string(r.bytes())
+			if _, ok := group.Elements[key]; ok {
+				return nil, ErrInvalidSnapshot
+			}
+			group.Elements[key] = &Element{Key: key, Payload: r.bytes()}
+		}
+		if _, ok := groups[name]; ok {
+			return nil, ErrInvalidSnapshot
+		}
+		groups[name] = group
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) != 0 {
+		return nil, ErrInvalidSnapshot
+	}
+	return groups, nil
+}
+
+// RestoreBinary restores the CHash from a snapshot written by MarshalBinary.
+// It uses the default RestoreOptions.
+func (c *CHash) RestoreBinary(data []byte) error {
+	return c.RestoreBinaryWithOptions(data, RestoreOptions{})
+}
+
+// RestoreBinaryWithOptions restores the CHash from a snapshot written by MarshalBinary,
+// validating and applying it exactly like RestoreWithOptions does for JSON.
+func (c *CHash) RestoreBinaryWithOptions(data []byte, opts RestoreOptions) (err error) {
+	start := time.Now()
+	defer func() {
+		c.restores.observe(time.Since(start), err)
+	}()
+
+	groups, err := decodeBinary(data)
+	if err != nil {
+		return err
+	}
+	return c.restoreGroups(groups, opts)
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCHashMarshalBinary(t *testing.T) {
+	hash := New()
+	db, _ := hash.CreateGroup("db", 100)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	db.Insert("192.168.1.101:3306", nil)
+	hash.CreateGroup("redis", 10)
+
+	data, err := hash.MarshalBinary()
+	assert.Nil(t, err)
+	assert.True(t, IsBinarySnapshot(data))
+	again, _ := hash.MarshalBinary()
+	assert.Equal(t, data, again)
+
+	restored := New()
+	assert.Nil(t, restored.RestoreBinary(data))
+	group, err := restored.GetGroup("db")
+	assert.Nil(t, err)
+	assert.Equal(t, 100, group.NumberOfReplicas)
+	assert.Equal(t, []byte("mysql0"), group.Elements["192.168.1.100:3306"].Payload)
+	assert.Nil(t, group.Elements["192.168.1.101:3306"].Payload)
+
+	expected, _, _ := db.Match("user-id-1")
+	matched, _, _ := group.Match("user-id-1")
+	assert.Equal(t, expected, matched)
+
+	json, _ := hash.Serialize()
+	fromJSON := New()
+	fromJSON.Restore(json)
+	again, _ = fromJSON.MarshalBinary()
+	assert.Equal(t, data, again)
+}
+
+func TestCHashRestoreBinaryInvalid(t *testing.T) {
+	hash := New()
+	hash.CreateGroup("db", 100)
+	data, _ := hash.MarshalBinary()
+
+	restored := New()
+	assert.Equal(t, ErrInvalidSnapshot, restored.RestoreBinary([]byte(`{}`)))
+	assert.Equal(t, ErrInvalidSnapshot, restored.RestoreBinary([]byte("CHSH\x02\x00")))
+	assert.Equal(t, ErrInvalidSnapshot, restored.RestoreBinary(data[:len(data)-1]))
+	assert.Equal(t, ErrInvalidSnapshot, restored.RestoreBinary(append(data, 0)))
+	assert.Equal(t, ErrInvalidSnapshot, restored.RestoreBinary([]byte("CHSH\x01\xff\xff\xff\xff\x0f")))
+	assert.Equal(t, ErrInvalidReplicas, restored.RestoreBinary([]byte("CHSH\x01\x01\x02db\x00\x00")))
+	assert.Equal(t, ErrInvalidSnapshot, restored.RestoreBinary([]byte("CHSH\x01\x01\x02db\x01\x02\x01a\x00\x01a\x00")))
+	assert.Equal(t, ErrTooManyElements, restored.RestoreBinaryWithOptions([]byte("CHSH\x01\x01\x02db\x01\x02\x01a\x00\x01b\x00"), RestoreOptions{MaxElements: 1}))
+	assert.Equal(t, 0, len(restored.GetGroups()))
+}
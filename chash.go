@@ -12,7 +12,9 @@ import (
 // CHash a warpper of Consistent hashing
 type CHash struct {
 	sync.RWMutex
-	groups map[string]*Group
+	groups   map[string]*Group
+	hub      hub
+	restores restoreStats
 }
 
 func New() *CHash {
@@ -32,8 +34,23 @@ func (c *CHash) GetGroup(groupName string) (*Group, error) {
 	return group, nil
 }
 
-// CreateGroup creates a new group with the given name and the number of replicas
+// GetGroups returns all groups sorted by name
+func (c *CHash) GetGroups() []*Group {
+	c.RLock()
+	defer c.RUnlock()
+	groups := make([]*Group, 0, len(c.groups))
+	for _, name := range sortedNames(c.groups) {
+		groups = append(groups, c.groups[name])
+	}
+	return groups
+}
+
+// CreateGroup creates a new group with the given name and the number of replicas.
+// It returns ErrInvalidReplicas if replicas is not positive.
 func (c *CHash) CreateGroup(groupName string, replicas int) (*Group, error) {
+	if replicas <= 0 {
+		return nil, ErrInvalidReplicas
+	}
 	c.Lock()
 	defer c.Unlock()
 	if existing, ok := c.groups[groupName]; ok {
@@ -41,15 +58,28 @@ func (c *CHash) CreateGroup(groupName string, replicas int) (*Group, error) {
 	}
 
 	group := NewGroup(groupName, replicas)
-	c.groups[groupName] = group
+	c.adopt(group)
 	return group, nil
 }
 
+// adopt adds a group to the registry and forwards its events to the CHash watchers.
+// The caller must hold the CHash lock.
+func (c *CHash) adopt(group *Group) {
+	group.Lock()
+	group.owner = &c.hub
+	group.Unlock()
+	c.groups[group.Name] = group
+	c.hub.publish(Event{Type: GroupCreated, Group: group.Name})
+}
+
 // RemoveGroup removes a group by name
 func (c *CHash) RemoveGroup(groupName string) {
 	c.Lock()
 	defer c.Unlock()
-	delete(c.groups, groupName)
+	if group, ok := c.groups[groupName]; ok {
+		group.markRemoved()
+		delete(c.groups, groupName)
+	}
 }
 
 // RemoveAllGroup removes all groups
@@ -57,7 +87,8 @@ func (c *CHash) RemoveAllGroup() {
 	c.Lock()
 	defer c.Unlock()
 
-	for k := range c.groups {
+	for k, group := range c.groups {
+		group.markRemoved()
 		delete(c.groups, k)
 	}
 }
@@ -81,8 +112,7 @@ func (c *CHash) Delete(groupName string, key string) error {
 	if !ok {
 		return ErrGroupNotFound
 	}
-	group.Delete(key)
-	return nil
+	return group.Delete(key)
 }
 
 // Match returns the key-value pair closest to the given key in a group
@@ -103,18 +133,8 @@ func (c *CHash) Serialize() ([]byte, error) {
 	return json.Marshal(c.groups)
 }
 
-// Restore deserializes a JSON representation of the CHash structure
+// Restore deserializes a JSON representation of the CHash structure,
+// replacing all existing groups. It uses the default RestoreOptions.
 func (c *CHash) Restore(data []byte) error {
-	c.Lock()
-	defer c.Unlock()
-	if err := json.Unmarshal(data, &c.groups); err != nil {
-		return err
-	}
-	for _, group := range c.groups {
-		group.Init()
-		for _, node := range group.Elements {
-			group.hashElement(node)
-		}
-	}
-	return nil
+	return c.RestoreWithOptions(data, RestoreOptions{})
 }
@@ -32,6 +32,27 @@ func TestCHashGetGroup(t *testing.T) {
 	assert.Equal(t, ErrGroupNotFound, err)
 }
 
+func TestCHashCreateGroupInvalidReplicas(t *testing.T) {
+	hash := New()
+	for _, replicas := range []int{0, -1} {
+		group, err := hash.CreateGroup("werbenhu1", replicas)
+		assert.Nil(t, group)
+		assert.Equal(t, ErrInvalidReplicas, err)
+	}
+	_, err := hash.GetGroup("werbenhu1")
+	assert.Equal(t, ErrGroupNotFound, err)
+
+	hash.CreateGroup("werbenhu1", 1)
+	hash.CreateGroup("werbenhu2", 100)
+	hash.Insert("werbenhu2", "192.168.1.101:8080", []byte("werbenhu101"))
+	data, err := hash.Serialize()
+	assert.Nil(t, err)
+	restored := New()
+	assert.Nil(t, restored.Restore(data))
+	again, _ := restored.Serialize()
+	assert.JSONEq(t, string(data), string(again))
+}
+
 func TestCHashCreateGroup(t *testing.T) {
 	hash := New()
 	group1, err := hash.CreateGroup("werbenhu1", 2000)
@@ -261,3 +282,14 @@ func TestCHashRestore(t *testing.T) {
 	err = hash.Restore(wrongData)
 	assert.NotNil(t, err)
 }
+
+func TestCHashGetGroups(t *testing.T) {
+	hash := New()
+	hash.CreateGroup("redis", 10)
+	hash.CreateGroup("db", 10)
+
+	groups := hash.GetGroups()
+	assert.Equal(t, 2, len(groups))
+	assert.Equal(t, "db", groups[0].Name)
+	assert.Equal(t, "redis", groups[1].Name)
+}
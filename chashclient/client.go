@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+// Package chashclient keeps a local read-only copy of a centrally managed CHash.
+// A Client polls an HTTP endpoint serving CHash.Serialize or CHash.MarshalBinary
+// output, such as GET /snapshot of chash-server, with If-None-Match so unchanged
+// snapshots are not downloaded again, and answers lookups from the local copy.
+package chashclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/werbenhu/chash"
+)
+
+// Defaults used when the corresponding Options field is zero
+const (
+	DefaultInterval    = 10 * time.Second
+	DefaultMinBackoff  = time.Second
+	DefaultMaxBackoff  = time.Minute
+	DefaultMaxBodySize = 8 << 20
+)
+
+// ErrTooLarge is returned for a snapshot larger than Options.MaxBodySize
+var ErrTooLarge = errors.New("chashclient: snapshot too large")
+
+// Options configures a Client
+type Options struct {
+	// Interval is the time between two polls while the endpoint is reachable.
+	Interval time.Duration
+
+	// MinBackoff and MaxBackoff bound the time between two polls after a failure.
+	// The backoff starts at MinBackoff and doubles with every consecutive failure.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// HTTPClient sends the requests, nil meaning http.DefaultClient.
+	HTTPClient *http.Client
+
+	// MaxBodySize limits the size of a downloaded snapshot.
+	MaxBodySize int64
+
+	// Restore holds the limits snapshots are validated against.
+	// Its Mode is ignored, every snapshot replaces the local groups.
+	Restore chash.RestoreOptions
+}
+
+// Client mirrors the CHash served at a URL into a local CHash
+type Client struct {
+	url        string
+	hash       *chash.CHash
+	http       *http.Client
+	interval   time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	maxBody    int64
+	restore    chash.RestoreOptions
+
+	// syncMu serializes Sync, so an older snapshot is never applied after a newer one.
+	syncMu sync.Mutex
+
+	mu       sync.Mutex
+	etag     string
+	lastSync time.Time
+	lastErr  error
+	failures int
+
+	cancel    context.CancelFunc
+	ctx       context.Context
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// New creates a client for the snapshot at the given URL. Lookups fail with
+// chash.ErrGroupNotFound until the first snapshot was applied, see LastSync.
+func New(url string, opts Options) *Client {
+	c := &Client{
+		url:        url,
+		hash:       chash.New(),
+		http:       opts.HTTPClient,
+		interval:   opts.Interval,
+		minBackoff: opts.MinBackoff,
+		maxBackoff: opts.MaxBackoff,
+		maxBody:    opts.MaxBodySize,
+		restore:    opts.Restore,
+		done:       make(chan struct{}),
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	if c.interval <= 0 {
+		c.interval = DefaultInterval
+	}
+	if c.minBackoff <= 0 {
+		c.minBackoff = DefaultMinBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = DefaultMaxBackoff
+	}
+	if c.maxBackoff < c.minBackoff {
+		c.maxBackoff = c.minBackoff
+	}
+	if c.maxBody <= 0 {
+		c.maxBody = DefaultMaxBodySize
+	}
+	c.restore.Mode = chash.RestoreReplace
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+// CHash returns the local copy. It is replaced by every new snapshot,
+// so changes made to it directly do not last.
+func (c *Client) CHash() *chash.CHash {
+	return c.hash
+}
+
+// Match returns the element and payload of the key in the local copy of the group
+func (c *Client) Match(groupName string, key string) (string, []byte, error) {
+	return c.hash.Match(groupName, key)
+}
+
+// GetGroup returns a group of the local copy
+func (c *Client) GetGroup(groupName string) (*chash.Group, error) {
+	return c.hash.GetGroup(groupName)
+}
+
+// LastSync returns the time of the last successful poll, whether it applied a
+// new snapshot or found the local copy up to date. It is zero before the first one.
+func (c *Client) LastSync() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastSync
+}
+
+// Err returns the error of the last poll, nil if it succeeded
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErr
+}
+
+// fetch downloads the snapshot unless it still has the given ETag.
+// It returns a nil snapshot when the server answers 304 Not Modified.
+func (c *Client) fetch(ctx context.Context, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req = req.WithContext(ctx)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("chashclient: unexpected status %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.maxBody+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > c.maxBody {
+		return nil, "", ErrTooLarge
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// apply restores a downloaded snapshot into the local copy, replacing all groups at once
+func (c *Client) apply(data []byte) error {
+	if chash.IsBinarySnapshot(data) {
+		return c.hash.RestoreBinaryWithOptions(data, c.restore)
+	}
+	return c.hash.RestoreWithOptions(data, c.restore)
+}
+
+// Sync polls the endpoint once and reports whether a new snapshot was applied.
+// A snapshot that fails to restore leaves the local copy untouched.
+// Concurrent calls are serialized.
+func (c *Client) Sync(ctx context.Context) (bool, error) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	c.mu.Lock()
+	etag := c.etag
+	c.mu.Unlock()
+
+	data, etag, err := c.fetch(ctx, etag)
+	if err == nil && data != nil {
+		err = c.apply(data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+	if err != nil {
+		c.failures++
+		return false, err
+	}
+	c.failures = 0
+	c.etag = etag
+	c.lastSync = time.Now()
+	return data != nil, nil
+}
+
+// delay returns the time to wait before the next poll
+func (c *Client) delay() time.Duration {
+	c.mu.Lock()
+	failures := c.failures
+	c.mu.Unlock()
+	if failures == 0 {
+		return c.interval
+	}
+	backoff := c.minBackoff
+	for i := 1; i < failures && backoff < c.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.maxBackoff {
+		backoff = c.maxBackoff
+	}
+	return backoff
+}
+
+// Start polls the endpoint right away and then in a background goroutine until Stop is called
+func (c *Client) Start() {
+	c.startOnce.Do(func() {
+		go c.loop()
+	})
+}
+
+// loop is the background goroutine of the client
+func (c *Client) loop() {
+	defer close(c.done)
+	for {
+		c.Sync(c.ctx)
+		timer := time.NewTimer(c.delay())
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop stops the background goroutine, cancelling a poll in flight, and waits for it to exit.
+// A stopped client cannot be started again, its local copy can still be used.
+func (c *Client) Stop() {
+	c.stopOnce.Do(func() {
+		c.cancel()
+	})
+	c.startOnce.Do(func() {
+		close(c.done)
+	})
+	<-c.done
+}
@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chashclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+// origin serves a snapshot of a CHash with an ETag and counts full downloads
+type origin struct {
+	sync.Mutex
+	hash      *chash.CHash
+	binary    bool
+	status    int
+	downloads int
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.Lock()
+	defer o.Unlock()
+	if o.status != 0 {
+		http.Error(w, "unavailable", o.status)
+		return
+	}
+	var data []byte
+	if o.binary {
+		data, _ = o.hash.MarshalBinary()
+	} else {
+		data, _ = o.hash.Serialize()
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	o.downloads++
+	w.Write(data)
+}
+
+// waitFor polls cond until it holds or fails the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+// serve starts an origin for a CHash with a db group of two elements
+func serve() (*origin, *httptest.Server) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 100)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	db.Insert("192.168.1.101:3306", []byte("mysql1"))
+	o := &origin{hash: hash}
+	return o, httptest.NewServer(o)
+}
+
+func TestClientSync(t *testing.T) {
+	o, srv := serve()
+	defer srv.Close()
+	client := New(srv.URL, Options{})
+
+	_, _, err := client.Match("db", "user-id-1")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+	assert.True(t, client.LastSync().IsZero())
+
+	applied, err := client.Sync(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	expected, _, _ := o.hash.Match("db", "user-id-1")
+	element, payload, err := client.Match("db", "user-id-1")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, element)
+	assert.Equal(t, "mysql"+element[12:13], string(payload))
+	first := client.LastSync()
+	assert.False(t, first.IsZero())
+
+	applied, err = client.Sync(context.Background())
+	assert.Nil(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, 1, o.downloads)
+	assert.False(t, client.LastSync().Before(first))
+
+	group, _ := client.GetGroup("db")
+	o.Lock()
+	o.hash.RemoveGroup("db")
+	o.hash.CreateGroup("redis", 10)
+	o.binary = true
+	o.Unlock()
+	applied, err = client.Sync(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, 2, o.downloads)
+	_, err = client.GetGroup("db")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+	_, _, err = group.Match("user-id-1")
+	assert.Equal(t, chash.ErrGroupRemoved, err)
+	_, err = client.GetGroup("redis")
+	assert.Nil(t, err)
+}
+
+func TestClientFailure(t *testing.T) {
+	o, srv := serve()
+	defer srv.Close()
+	client := New(srv.URL, Options{MaxBodySize: 1 << 20})
+	client.Sync(context.Background())
+	last := client.LastSync()
+
+	o.Lock()
+	o.status = http.StatusServiceUnavailable
+	o.Unlock()
+	applied, err := client.Sync(context.Background())
+	assert.False(t, applied)
+	assert.NotNil(t, err)
+	assert.Equal(t, err, client.Err())
+	assert.Equal(t, last, client.LastSync())
+	_, _, err = client.Match("db", "user-id-1")
+	assert.Nil(t, err)
+
+	small := New(srv.URL, Options{MaxBodySize: 10})
+	o.Lock()
+	o.status = 0
+	o.Unlock()
+	_, err = small.Sync(context.Background())
+	assert.Equal(t, ErrTooLarge, err)
+
+	invalid := New(srv.URL, Options{Restore: chash.RestoreOptions{MaxElements: 1}})
+	_, err = invalid.Sync(context.Background())
+	assert.Equal(t, chash.ErrTooManyElements, err)
+	_, err = invalid.GetGroup("db")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+
+	client.Sync(context.Background())
+	assert.Nil(t, client.Err())
+}
+
+func TestClientSyncSerialized(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 10)
+	db.Insert("192.168.1.100:3306", nil)
+	started, release := make(chan struct{}), make(chan struct{})
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := hash.Serialize()
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+			<-release
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	client := New(srv.URL, Options{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		client.Sync(context.Background())
+	}()
+	<-started
+	db.Insert("192.168.1.101:3306", nil)
+	go func() {
+		defer wg.Done()
+		client.Sync(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	group, err := client.GetGroup("db")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(group.GetElements()))
+}
+
+func TestClientBackoff(t *testing.T) {
+	client := New("http://127.0.0.1:0", Options{Interval: time.Minute, MinBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	assert.Equal(t, time.Minute, client.delay())
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		client.failures++
+		assert.Equal(t, expected, client.delay())
+	}
+
+	defaults := New("http://127.0.0.1:0", Options{})
+	assert.Equal(t, DefaultInterval, defaults.delay())
+	defaults.failures = 100
+	assert.Equal(t, DefaultMaxBackoff, defaults.delay())
+}
+
+func TestClientStartStop(t *testing.T) {
+	o, srv := serve()
+	defer srv.Close()
+	client := New(srv.URL, Options{Interval: 10 * time.Millisecond})
+	client.Start()
+	client.Start()
+
+	waitFor(t, func() bool {
+		_, _, err := client.Match("db", "user-id-1")
+		return err == nil
+	})
+
+	o.Lock()
+	o.hash.Insert("db", "192.168.1.102:3306", nil)
+	o.Unlock()
+	waitFor(t, func() bool {
+		group, err := client.GetGroup("db")
+		return err == nil && len(group.GetElements()) == 3
+	})
+
+	client.Stop()
+	client.Stop()
+	New(srv.URL, Options{}).Stop()
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chashrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+
+	"github.com/werbenhu/chash"
+)
+
+// knownErrors are the errors of chash that are mapped back from their message,
+// so remote calls can be compared against the same values as local ones
+var knownErrors = map[string]error{}
+
+func init() {
+	for _, err := range []error{
+		chash.ErrGroupNotFound,
+		chash.ErrGroupExisted,
+		chash.ErrNoResultMatched,
+		chash.ErrKeyExisted,
+		chash.ErrInvalidSnapshot,
+		chash.ErrTooManyGroups,
+		chash.ErrTooManyElements,
+		chash.ErrTooManyPoints,
+		chash.ErrInvalidReplicas,
+		chash.ErrGroupRemoved,
+		chash.ErrKeyNotFound,
+		chash.ErrNoHealthyElement,
+	} {
+		knownErrors[err.Error()] = err
+	}
+}
+
+// mapError turns an error returned by the service back into the error of chash
+func mapError(err error) error {
+	var serverErr rpc.ServerError
+	if errors.As(err, &serverErr) {
+		if known, ok := knownErrors[string(serverErr)]; ok {
+			return known
+		}
+	}
+	return err
+}
+
+// Client calls a remote CHash service. It implements API, groups returned by
+// CreateGroup and GetGroup are detached copies that can be matched locally.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to a CHash service at the given address
+func Dial(network string, address string) (*Client, error) {
+	client, err := jsonrpc.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: client}, nil
+}
+
+// NewClient creates a client using an established connection
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{rpc: jsonrpc.NewClient(conn)}
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// call invokes a method of the service
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+	return mapError(c.rpc.Call(ServiceName+"."+method, args, reply))
+}
+
+// decodeGroup rebuilds a group received from the service within the default restore limits
+func decodeGroup(reply GroupReply) (*chash.Group, error) {
+	var group struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(reply.Group, &group); err != nil {
+		return nil, err
+	}
+	snapshot, err := json.Marshal(map[string]json.RawMessage{group.Name: reply.Group})
+	if err != nil {
+		return nil, err
+	}
+	hash := chash.New()
+	if err := hash.RestoreWithOptions(snapshot, chash.RestoreOptions{}); err != nil {
+		return nil, err
+	}
+	return hash.GetGroup(group.Name)
+}
+
+// CreateGroup creates a group on the service. Like CHash.CreateGroup it returns
+// the existing group together with ErrGroupExisted if the name is taken.
+func (c *Client) CreateGroup(groupName string, replicas int) (*chash.Group, error) {
+	var reply GroupReply
+	err := c.call("CreateGroup", GroupArgs{Group: groupName, Replicas: replicas}, &reply)
+	if err == chash.ErrGroupExisted {
+		existing, getErr := c.GetGroup(groupName)
+		if getErr != nil {
+			return nil, getErr
+		}
+		return existing, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeGroup(reply)
+}
+
+// GetGroup returns a copy of a group of the service
+func (c *Client) GetGroup(groupName string) (*chash.Group, error) {
+	var reply GroupReply
+	if err := c.call("GetGroup", GroupArgs{Group: groupName}, &reply); err != nil {
+		return nil, err
+	}
+	return decodeGroup(reply)
+}
+
+// Insert inserts an element into a group of the service
+func (c *Client) Insert(groupName string, key string, payload []byte) error {
+	return c.call("Insert", ElementArgs{Group: groupName, Key: key, Payload: payload}, &Empty{})
+}
+
+// Delete removes an element from a group of the service
+func (c *Client) Delete(groupName string, key string) error {
+	return c.call("Delete", ElementArgs{Group: groupName, Key: key}, &Empty{})
+}
+
+// Match returns the element of a key in a group of the service
+func (c *Client) Match(groupName string, key string) (string, []byte, error) {
+	var reply MatchReply
+	if err := c.call("Match", ElementArgs{Group: groupName, Key: key}, &reply); err != nil {
+		return "", nil, err
+	}
+	return reply.Element, reply.Payload, nil
+}
+
+// Serialize returns a snapshot of the service's CHash
+func (c *Client) Serialize() ([]byte, error) {
+	var reply SnapshotReply
+	if err := c.call("Serialize", Empty{}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Data, nil
+}
+
+// Restore replaces all groups of the service's CHash with a snapshot
+func (c *Client) Restore(data []byte) error {
+	return c.call("Restore", SnapshotArgs{Data: data}, &Empty{})
+}
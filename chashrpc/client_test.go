@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chashrpc
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+// dial serves the CHash on a random local port and connects a client to it
+func dial(t *testing.T, hash *chash.CHash) (*Client, func()) {
+	server, err := NewServer(hash)
+	assert.Nil(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go Serve(l, server)
+
+	client, err := Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	return client, func() {
+		client.Close()
+		l.Close()
+	}
+}
+
+// exercise runs the same calls against a local or remote API
+func exercise(t *testing.T, api API) {
+	group, err := api.CreateGroup("db", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, "db", group.Name)
+	_, err = api.CreateGroup("db", 100)
+	assert.Equal(t, chash.ErrGroupExisted, err)
+
+	assert.Nil(t, api.Insert("db", "192.168.1.100:3306", []byte("mysql0")))
+	assert.Nil(t, api.Insert("db", "192.168.1.101:3306", []byte("mysql1")))
+	assert.Equal(t, chash.ErrKeyExisted, api.Insert("db", "192.168.1.101:3306", nil))
+	assert.Equal(t, chash.ErrGroupNotFound, api.Insert("redis", "192.168.1.100:6379", nil))
+
+	element, payload, err := api.Match("db", "user-id-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "mysql"+element[12:13], string(payload))
+
+	group, err = api.GetGroup("db")
+	assert.Nil(t, err)
+	local, _, _ := group.Match("user-id-1")
+	assert.Equal(t, element, local)
+
+	assert.Nil(t, api.Delete("db", "192.168.1.101:3306"))
+	element, _, _ = api.Match("db", "user-id-1")
+	assert.Equal(t, "192.168.1.100:3306", element)
+
+	data, err := api.Serialize()
+	assert.Nil(t, err)
+	assert.Nil(t, api.Restore([]byte(`{"redis":{"name":"redis","numberOfReplicas":10}}`)))
+	_, err = api.GetGroup("db")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+	_, _, err = api.Match("redis", "user-id-1")
+	assert.Equal(t, chash.ErrNoResultMatched, err)
+	assert.Equal(t, chash.ErrInvalidReplicas, api.Restore([]byte(`{"db":{"name":"db","numberOfReplicas":-1}}`)))
+
+	assert.Nil(t, api.Restore(data))
+	element, _, _ = api.Match("db", "user-id-1")
+	assert.Equal(t, "192.168.1.100:3306", element)
+}
+
+func TestLocal(t *testing.T) {
+	exercise(t, chash.New())
+}
+
+func TestClient(t *testing.T) {
+	hash := chash.New()
+	client, stop := dial(t, hash)
+	defer stop()
+	exercise(t, client)
+
+	group, _ := hash.GetGroup("db")
+	assert.Equal(t, 1, len(group.GetElements()))
+
+	_, err := client.CreateGroup("redis", chash.DefaultMaxReplicas+1)
+	assert.Equal(t, chash.ErrInvalidReplicas, err)
+	_, err = client.CreateGroup("redis", 0)
+	assert.Equal(t, chash.ErrInvalidReplicas, err)
+	_, err = hash.GetGroup("redis")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+}
+
+func TestDecodeGroupLimits(t *testing.T) {
+	_, err := decodeGroup(GroupReply{Group: []byte(`{"name":"db","numberOfReplicas":1000000000}`)})
+	assert.Equal(t, chash.ErrInvalidReplicas, err)
+	group, err := decodeGroup(GroupReply{Group: []byte(`{"name":"db","numberOfReplicas":10,"elements":{"a":{"key":"a"}}}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(group.GetElements()))
+}
+
+func TestMapError(t *testing.T) {
+	assert.Equal(t, chash.ErrGroupNotFound, mapError(rpc.ServerError("group not found")))
+	assert.Equal(t, rpc.ServerError("boom"), mapError(rpc.ServerError("boom")))
+	assert.Equal(t, rpc.ErrShutdown, mapError(rpc.ErrShutdown))
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+// Package chashrpc exposes a CHash as a net/rpc service using the JSON-RPC codec,
+// and provides a Client with the same API as a local CHash, so callers can switch
+// between in-process and remote rings by configuration.
+package chashrpc
+
+import (
+	"encoding/json"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+
+	"github.com/werbenhu/chash"
+)
+
+// ServiceName is the name the service is registered under
+const ServiceName = "CHash"
+
+// API is the part of the CHash API available both in-process and remotely
+type API interface {
+	CreateGroup(groupName string, replicas int) (*chash.Group, error)
+	GetGroup(groupName string) (*chash.Group, error)
+	Insert(groupName string, key string, payload []byte) error
+	Delete(groupName string, key string) error
+	Match(groupName string, key string) (string, []byte, error)
+	Serialize() ([]byte, error)
+	Restore(data []byte) error
+}
+
+var (
+	_ API = (*chash.CHash)(nil)
+	_ API = (*Client)(nil)
+)
+
+// Empty is the argument or reply of methods that have none
+type Empty struct{}
+
+// GroupArgs names a group
+type GroupArgs struct {
+	Group    string
+	Replicas int
+}
+
+// GroupReply holds a group encoded as in a snapshot
+type GroupReply struct {
+	Group json.RawMessage
+}
+
+// ElementArgs names an element of a group
+type ElementArgs struct {
+	Group   string
+	Key     string
+	Payload []byte
+}
+
+// MatchReply is the result of a lookup
+type MatchReply struct {
+	Element string
+	Payload []byte
+}
+
+// SnapshotArgs holds a serialized CHash
+type SnapshotArgs struct {
+	Data []byte
+}
+
+// SnapshotReply holds a serialized CHash
+type SnapshotReply struct {
+	Data []byte
+}
+
+// Service is the RPC service of a CHash
+type Service struct {
+	hash *chash.CHash
+}
+
+// NewServer creates an RPC server with the service of the CHash registered
+func NewServer(hash *chash.CHash) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, &Service{hash: hash}); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// Serve accepts connections on the listener and serves them with the JSON-RPC codec
+// until the listener fails or is closed
+func Serve(l net.Listener, server *rpc.Server) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// encodeGroup encodes a group into the reply
+func encodeGroup(group *chash.Group, reply *GroupReply) error {
+	data, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	reply.Group = data
+	return nil
+}
+
+// CreateGroup creates a group, the number of replicas must be between 1 and chash.DefaultMaxReplicas
+func (s *Service) CreateGroup(args GroupArgs, reply *GroupReply) error {
+	if args.Replicas <= 0 || args.Replicas > chash.DefaultMaxReplicas {
+		return chash.ErrInvalidReplicas
+	}
+	group, err := s.hash.CreateGroup(args.Group, args.Replicas)
+	if err != nil {
+		return err
+	}
+	return encodeGroup(group, reply)
+}
+
+// GetGroup returns a group
+func (s *Service) GetGroup(args GroupArgs, reply *GroupReply) error {
+	group, err := s.hash.GetGroup(args.Group)
+	if err != nil {
+		return err
+	}
+	return encodeGroup(group, reply)
+}
+
+// Insert inserts an element into a group
+func (s *Service) Insert(args ElementArgs, reply *Empty) error {
+	return s.hash.Insert(args.Group, args.Key, args.Payload)
+}
+
+// Delete removes an element from a group
+func (s *Service) Delete(args ElementArgs, reply *Empty) error {
+	return s.hash.Delete(args.Group, args.Key)
+}
+
+// Match returns the element of a key in a group
+func (s *Service) Match(args ElementArgs, reply *MatchReply) error {
+	element, payload, err := s.hash.Match(args.Group, args.Key)
+	if err != nil {
+		return err
+	}
+	reply.Element, reply.Payload = element, payload
+	return nil
+}
+
+// Serialize returns a snapshot of the CHash
+func (s *Service) Serialize(args Empty, reply *SnapshotReply) error {
+	data, err := s.hash.Serialize()
+	if err != nil {
+		return err
+	}
+	reply.Data = data
+	return nil
+}
+
+// Restore replaces all groups of the CHash with a snapshot
+func (s *Service) Restore(args SnapshotArgs, reply *Empty) error {
+	return s.hash.Restore(args.Data)
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+// Command chash-server serves consistent hashing lookups and administration
+// of a CHash over a JSON REST API.
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/werbenhu/chash"
+	"github.com/werbenhu/chash/resp"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	respAddr := flag.String("resp", "", "address to serve the Redis protocol on, disabled if empty")
+	snapshot := flag.String("snapshot", "", "snapshot file to restore at startup")
+	timeout := flag.Duration("shutdown-timeout", 10*time.Second, "time to wait for requests to finish on shutdown")
+	flag.Parse()
+
+	hash := chash.New()
+	if *snapshot != "" {
+		data, err := ioutil.ReadFile(*snapshot)
+		if err != nil {
+			log.Fatalf("chash-server: %v", err)
+		}
+		if err := hash.Restore(data); err != nil {
+			log.Fatalf("chash-server: restore %s: %v", *snapshot, err)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           NewServer(hash),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var respSrv *resp.Server
+	if *respAddr != "" {
+		respSrv = resp.NewServer(hash, resp.Options{})
+		go func() {
+			log.Printf("chash-server: serving the Redis protocol on %s", *respAddr)
+			if err := respSrv.ListenAndServe(*respAddr); err != resp.ErrServerClosed {
+				log.Fatalf("chash-server: %v", err)
+			}
+		}()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("chash-server: shutdown: %v", err)
+		}
+		if respSrv != nil {
+			respSrv.Close()
+		}
+	}()
+
+	log.Printf("chash-server: listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("chash-server: %v", err)
+	}
+	<-stopped
+}
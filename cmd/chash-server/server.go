@@ -0,0 +1,448 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/werbenhu/chash"
+)
+
+// DefaultMaxBodySize is the largest request body accepted by the server.
+const DefaultMaxBodySize = 8 << 20
+
+// MaxRenderParams is the largest number of key, add and remove parameters of a ring rendering
+const MaxRenderParams = 64
+
+// groupRequest is the body of POST /groups
+type groupRequest struct {
+	Name     string `json:"name"`
+	Replicas int    `json:"replicas"`
+}
+
+// groupInfo describes a group in GET /groups
+type groupInfo struct {
+	Name        string `json:"name"`
+	Replicas    int    `json:"replicas"`
+	Elements    int    `json:"elements"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// FingerprintHeader carries the fingerprint of the group or CHash of a response,
+// so routers can compare their rings without comparing the bodies
+const FingerprintHeader = "X-Chash-Fingerprint"
+
+// elementRequest is the body of POST /groups/{g}/elements and PUT /groups/{g}/elements/{key}
+type elementRequest struct {
+	Key     string `json:"key"`
+	Payload []byte `json:"payload"`
+}
+
+// matchRequest is the body of POST /groups/{g}/match
+type matchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// matchResult is the result of a single lookup
+type matchResult struct {
+	Key     string `json:"key"`
+	Element string `json:"element,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// statusOf maps the errors of chash to HTTP status codes
+var statusOf = map[error]int{
+	chash.ErrGroupNotFound:    http.StatusNotFound,
+	chash.ErrGroupRemoved:     http.StatusNotFound,
+	chash.ErrNoResultMatched:  http.StatusNotFound,
+	chash.ErrGroupExisted:     http.StatusConflict,
+	chash.ErrKeyExisted:       http.StatusConflict,
+	chash.ErrNoHealthyElement: http.StatusServiceUnavailable,
+}
+
+// Server serves a CHash over a JSON REST API:
+//
+//	GET    /groups                      list the groups
+//	POST   /groups                      create a group
+//	GET    /groups/{g}                  get a group with its elements and fingerprint header
+//	DELETE /groups/{g}                  remove a group
+//	POST   /groups/{g}/elements         insert an element
+//	PUT    /groups/{g}/elements/{key}   insert or update an element
+//	DELETE /groups/{g}/elements/{key}   delete an element
+//	GET    /groups/{g}/match?key=       match a key
+//	POST   /groups/{g}/match            match a batch of keys
+//	GET    /groups/{g}/ring.svg         draw the ring as SVG
+//	GET    /groups/{g}/ring.dot         draw the ring as a Graphviz digraph
+//	GET    /snapshot                    download a snapshot, its ETag is the CHash fingerprint
+//	PUT    /snapshot                    restore a snapshot
+//	GET    /metrics                     Prometheus metrics
+type Server struct {
+	hash        *chash.CHash
+	metrics     http.Handler
+	maxBodySize int64
+}
+
+// NewServer creates a server for the given CHash
+func NewServer(hash *chash.CHash) *Server {
+	return &Server{
+		hash:        hash,
+		metrics:     chash.MetricsHandler(hash),
+		maxBodySize: DefaultMaxBodySize,
+	}
+}
+
+// writeJSON writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err with the status it maps to, or 400 Bad Request
+func writeError(w http.ResponseWriter, err error) {
+	status, ok := statusOf[err]
+	if !ok {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// notAllowed answers a request whose method the path does not support
+func notAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+}
+
+// decode reads the JSON body of the request into v
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodySize)).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return false
+	}
+	return true
+}
+
+// segments splits the escaped path into unescaped segments,
+// so element keys may contain escaped slashes
+func segments(r *http.Request) ([]string, bool) {
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, false
+		}
+		parts[i] = unescaped
+	}
+	return parts, true
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts, ok := segments(r)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid path"})
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "groups":
+		s.serveGroups(w, r)
+	case len(parts) == 2 && parts[0] == "groups":
+		s.serveGroup(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "groups" && parts[2] == "elements":
+		if r.Method != http.MethodPost {
+			notAllowed(w, "POST")
+			return
+		}
+		s.insert(w, r, parts[1])
+	case len(parts) == 4 && parts[0] == "groups" && parts[2] == "elements":
+		s.serveElement(w, r, parts[1], parts[3])
+	case len(parts) == 3 && parts[0] == "groups" && parts[2] == "match":
+		s.serveMatch(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "groups" && (parts[2] == "ring.svg" || parts[2] == "ring.dot"):
+		if r.Method != http.MethodGet {
+			notAllowed(w, "GET")
+			return
+		}
+		s.render(w, r, parts[1], parts[2] == "ring.svg")
+	case len(parts) == 1 && parts[0] == "snapshot":
+		s.serveSnapshot(w, r)
+	case len(parts) == 1 && parts[0] == "metrics":
+		s.metrics.ServeHTTP(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+	}
+}
+
+// serveGroups lists or creates groups
+func (s *Server) serveGroups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		groups := make([]groupInfo, 0)
+		for _, group := range s.hash.GetGroups() {
+			group.RLock()
+			info := groupInfo{
+				Name:     group.Name,
+				Replicas: group.NumberOfReplicas,
+				Elements: len(group.Elements),
+			}
+			group.RUnlock()
+			info.Fingerprint = group.Fingerprint()
+			groups = append(groups, info)
+		}
+		writeJSON(w, http.StatusOK, groups)
+
+	case http.MethodPost:
+		var req groupRequest
+		if !s.decode(w, r, &req) {
+			return
+		}
+		if req.Name == "" || strings.Contains(req.Name, "/") {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid group name"})
+			return
+		}
+		if req.Replicas <= 0 || req.Replicas > chash.DefaultMaxReplicas {
+			writeError(w, chash.ErrInvalidReplicas)
+			return
+		}
+		group, err := s.hash.CreateGroup(req.Name, req.Replicas)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, group)
+
+	default:
+		notAllowed(w, "GET, POST")
+	}
+}
+
+// serveGroup gets or removes a group
+func (s *Server) serveGroup(w http.ResponseWriter, r *http.Request, name string) {
+	group, err := s.hash.GetGroup(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set(FingerprintHeader, group.Fingerprint())
+		writeJSON(w, http.StatusOK, group)
+	case http.MethodDelete:
+		s.hash.RemoveGroup(name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		notAllowed(w, "GET, DELETE")
+	}
+}
+
+// insert adds a new element to a group
+func (s *Server) insert(w http.ResponseWriter, r *http.Request, name string) {
+	var req elementRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+	if req.Key == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid element key"})
+		return
+	}
+	if err := s.hash.Insert(name, req.Key, req.Payload); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, chash.Element{Key: req.Key, Payload: req.Payload})
+}
+
+// serveElement upserts or deletes an element of a group
+func (s *Server) serveElement(w http.ResponseWriter, r *http.Request, name string, key string) {
+	group, err := s.hash.GetGroup(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var req elementRequest
+		if !s.decode(w, r, &req) {
+			return
+		}
+		if err := group.Upsert(key, req.Payload); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, chash.Element{Key: key, Payload: req.Payload})
+	case http.MethodDelete:
+		if err := group.Delete(key); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		notAllowed(w, "PUT, DELETE")
+	}
+}
+
+// match looks up a single key
+func match(group *chash.Group, key string) (matchResult, error) {
+	element, payload, err := group.Match(key)
+	if err != nil {
+		return matchResult{Key: key, Error: err.Error()}, err
+	}
+	return matchResult{Key: key, Element: element, Payload: payload}, nil
+}
+
+// serveMatch matches a single key or a batch of keys
+func (s *Server) serveMatch(w http.ResponseWriter, r *http.Request, name string) {
+	group, err := s.hash.GetGroup(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "missing key"})
+			return
+		}
+		result, err := match(group, key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+
+	case http.MethodPost:
+		var req matchRequest
+		if !s.decode(w, r, &req) {
+			return
+		}
+		// a failed lookup is reported per key, so one empty group does not fail the batch
+		results := make([]matchResult, 0, len(req.Keys))
+		for _, key := range req.Keys {
+			result, _ := match(group, key)
+			results = append(results, result)
+		}
+		writeJSON(w, http.StatusOK, results)
+
+	default:
+		notAllowed(w, "GET, POST")
+	}
+}
+
+// render draws the ring of a group, highlighting the owners of the key parameters.
+// The add and remove parameters preview a membership change on a clone of the group,
+// drawing the ring before the change inside the ring after it.
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, svg bool) {
+	group, err := s.hash.GetGroup(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	if len(query["key"])+len(query["add"])+len(query["remove"]) > MaxRenderParams {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "too many parameters"})
+		return
+	}
+	opts := chash.RenderOptions{Keys: query["key"]}
+	if len(query["add"]) > 0 || len(query["remove"]) > 0 {
+		opts.Before = group
+		group = group.Clone()
+		for _, key := range query["add"] {
+			if key == "" {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid element key"})
+				return
+			}
+			// the clone is private to this request, so it is read without its lock
+			if _, ok := group.Elements[key]; !ok && len(group.Elements) >= chash.DefaultMaxElements {
+				writeError(w, chash.ErrTooManyElements)
+				return
+			}
+			group.Upsert(key, nil)
+		}
+		for _, key := range query["remove"] {
+			if err := group.Delete(key); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	contentType := chash.DOTContentType
+	if svg {
+		contentType = chash.SVGContentType
+		err = chash.RenderSVG(&buf, group, opts)
+	} else {
+		err = chash.RenderDOT(&buf, group, opts)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
+
+// etagMatch reports whether an If-None-Match header matches the ETag
+func etagMatch(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSnapshot downloads or restores a snapshot of the CHash
+func (s *Server) serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// the fingerprint is taken first, so a change racing with Serialize
+		// at worst makes the snapshot newer than its ETag, never older
+		fingerprint := s.hash.Fingerprint()
+		etag := `"` + fingerprint + `"`
+		w.Header().Set(FingerprintHeader, fingerprint)
+		w.Header().Set("ETag", etag)
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		data, err := s.hash.Serialize()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+		if err != nil {
+			writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "request body too large"})
+			return
+		}
+		if err := s.hash.Restore(data); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		notAllowed(w, "GET, PUT")
+	}
+}
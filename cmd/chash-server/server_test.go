@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+// do sends a request to the server and returns the status and body
+func do(t *testing.T, srv *httptest.Server, method string, path string, body string) (int, []byte) {
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	assert.Nil(t, err)
+	resp, err := srv.Client().Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+func TestServerGroups(t *testing.T) {
+	srv := httptest.NewServer(NewServer(chash.New()))
+	defer srv.Close()
+
+	status, _ := do(t, srv, "POST", "/groups", `{"name":"db","replicas":10}`)
+	assert.Equal(t, http.StatusCreated, status)
+	status, body := do(t, srv, "POST", "/groups", `{"name":"db","replicas":10}`)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.JSONEq(t, `{"error":"group already existed"}`, string(body))
+	status, _ = do(t, srv, "POST", "/groups", `{"name":"redis","replicas":0}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, srv, "POST", "/groups", `{"name":`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, body = do(t, srv, "GET", "/groups", "")
+	assert.Equal(t, http.StatusOK, status)
+	fingerprint := chash.NewGroup("db", 10).Fingerprint()
+	assert.JSONEq(t, `[{"name":"db","replicas":10,"elements":0,"fingerprint":"`+fingerprint+`"}]`, string(body))
+
+	status, body = do(t, srv, "GET", "/groups/db", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"name":"db","numberOfReplicas":10,"elements":{}}`, string(body))
+
+	resp, err := srv.Client().Get(srv.URL + "/groups/db")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, fingerprint, resp.Header.Get(FingerprintHeader))
+
+	status, _ = do(t, srv, "PATCH", "/groups/db", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+	status, _ = do(t, srv, "DELETE", "/groups/db", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do(t, srv, "GET", "/groups/db", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServerElements(t *testing.T) {
+	hash := chash.New()
+	srv := httptest.NewServer(NewServer(hash))
+	defer srv.Close()
+	hash.CreateGroup("db", 10)
+
+	status, _ := do(t, srv, "POST", "/groups/db/elements", `{"key":"192.168.1.100:3306","payload":"bXlzcWww"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = do(t, srv, "POST", "/groups/db/elements", `{"key":"192.168.1.100:3306"}`)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = do(t, srv, "POST", "/groups/redis/elements", `{"key":"192.168.1.100:6379"}`)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = do(t, srv, "PUT", "/groups/db/elements/192.168.1.101:3306", `{"payload":"bXlzcWwx"}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do(t, srv, "PUT", "/groups/db/elements/a%2Fb", `{}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	group, _ := hash.GetGroup("db")
+	assert.Equal(t, 3, len(group.GetElements()))
+	assert.Equal(t, []byte("mysql1"), group.Elements["192.168.1.101:3306"].Payload)
+	assert.NotNil(t, group.Elements["a/b"])
+
+	status, _ = do(t, srv, "DELETE", "/groups/db/elements/a%2Fb", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Nil(t, group.Elements["a/b"])
+}
+
+func TestServerMatch(t *testing.T) {
+	hash := chash.New()
+	srv := httptest.NewServer(NewServer(hash))
+	defer srv.Close()
+	group, _ := hash.CreateGroup("db", 100)
+	hash.CreateGroup("empty", 100)
+	group.Insert("192.168.1.100:3306", []byte("mysql0"))
+	group.Insert("192.168.1.101:3306", []byte("mysql1"))
+
+	element, payload, _ := group.Match("user-id-1")
+	status, body := do(t, srv, "GET", "/groups/db/match?key=user-id-1", "")
+	assert.Equal(t, http.StatusOK, status)
+	var result matchResult
+	assert.Nil(t, json.Unmarshal(body, &result))
+	assert.Equal(t, matchResult{Key: "user-id-1", Element: element, Payload: payload}, result)
+
+	status, _ = do(t, srv, "GET", "/groups/db/match", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, srv, "GET", "/groups/empty/match?key=user-id-1", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = do(t, srv, "POST", "/groups/db/match", `{"keys":["user-id-1","user-id-2"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	var results []matchResult
+	assert.Nil(t, json.Unmarshal(body, &results))
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, result, results[0])
+	assert.Equal(t, "user-id-2", results[1].Key)
+
+	status, body = do(t, srv, "POST", "/groups/empty/match", `{"keys":["user-id-1"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `[{"key":"user-id-1","error":"no result matched"}]`, string(body))
+}
+
+func TestServerSnapshot(t *testing.T) {
+	hash := chash.New()
+	srv := httptest.NewServer(NewServer(hash))
+	defer srv.Close()
+	group, _ := hash.CreateGroup("db", 10)
+	group.Insert("192.168.1.100:3306", []byte("mysql0"))
+
+	status, snapshot := do(t, srv, "GET", "/snapshot", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	other := chash.New()
+	otherSrv := httptest.NewServer(NewServer(other))
+	defer otherSrv.Close()
+	status, _ = do(t, otherSrv, "PUT", "/snapshot", string(snapshot))
+	assert.Equal(t, http.StatusNoContent, status)
+	restored, _ := other.Serialize()
+	assert.True(t, bytes.Equal(snapshot, restored))
+
+	status, body := do(t, otherSrv, "PUT", "/snapshot", `{"db":{"name":"db","numberOfReplicas":-1}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.JSONEq(t, `{"error":"invalid number of replicas"}`, string(body))
+}
+
+func TestServerSnapshotETag(t *testing.T) {
+	hash := chash.New()
+	srv := httptest.NewServer(NewServer(hash))
+	defer srv.Close()
+	group, _ := hash.CreateGroup("db", 10)
+
+	get := func(etag string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+"/snapshot", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := srv.Client().Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, `"`+hash.Fingerprint()+`"`, etag)
+	assert.Equal(t, hash.Fingerprint(), resp.Header.Get(FingerprintHeader))
+
+	resp = get(etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, get(`"other", W/`+etag).StatusCode)
+
+	group.Insert("192.168.1.100:3306", nil)
+	resp = get(etag)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+}
+
+func TestServerMetrics(t *testing.T) {
+	srv := httptest.NewServer(NewServer(chash.New()))
+	defer srv.Close()
+
+	status, body := do(t, srv, "GET", "/metrics", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, string(body), "chash_groups 0\n")
+
+	status, _ = do(t, srv, "GET", "/unknown", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServerRender(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 10)
+	db.Insert("192.168.1.100:3306", nil)
+	srv := httptest.NewServer(NewServer(hash))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/groups/db/ring.svg?key=user-id-1")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, chash.SVGContentType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "user-id-1 → 192.168.1.100:3306")
+
+	status, body := do(t, srv, "GET", "/groups/db/ring.dot?add=192.168.1.101:3306&key=user-id-1", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, string(body), `"element:192.168.1.100:3306" -> "element:192.168.1.101:3306"`)
+	assert.Equal(t, 1, len(db.Elements))
+
+	status, _ = do(t, srv, "GET", "/groups/db/ring.dot?remove=192.168.1.100:3306", "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do(t, srv, "GET", "/groups/db/ring.svg?add=", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, body = do(t, srv, "GET", "/groups/db/ring.svg?"+strings.Repeat("key=a&", MaxRenderParams)+"add=b", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, string(body), "too many parameters")
+
+	elements := make(map[string]*chash.Element, chash.DefaultMaxElements)
+	for i := 0; i < chash.DefaultMaxElements; i++ {
+		key := fmt.Sprintf("192.168.%d.%d:6379", i/256, i%256)
+		elements[key] = &chash.Element{Key: key}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"db": db, "cache": map[string]interface{}{"name": "cache", "numberOfReplicas": 1, "elements": elements}})
+	assert.Nil(t, hash.Restore(data))
+	status, body = do(t, srv, "GET", "/groups/cache/ring.dot?add=192.168.1.0:6379&add=10.0.0.1:6379", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, string(body), chash.ErrTooManyElements.Error())
+	status, _ = do(t, srv, "GET", "/groups/redis/ring.svg", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do(t, srv, "POST", "/groups/db/ring.svg", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+}
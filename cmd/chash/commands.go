@@ -0,0 +1,432 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/werbenhu/chash"
+	"github.com/werbenhu/chash/simulator"
+)
+
+// parse parses the flags of a subcommand, returning false with the exit code on failure
+func parse(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitError, false
+	}
+	return exitOK, true
+}
+
+// lookupResult is the result of matching a single key
+type lookupResult struct {
+	Key     string `json:"key"`
+	Element string `json:"element,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// lookup matches keys against a group of a snapshot
+func lookup(e *env, args []string) int {
+	fs := e.flags("lookup")
+	snapshot := fs.String("snapshot", "", "snapshot file")
+	group := fs.String("group", "", "group to match the keys in")
+	asJSON := fs.Bool("json", false, "write JSON output")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if *snapshot == "" || *group == "" {
+		return e.fail(exitError, "lookup: -snapshot and -group are required")
+	}
+	hash, err := loadSnapshot(*snapshot, chash.RestoreOptions{})
+	if err != nil {
+		return e.fail(exitError, "lookup: %s: %v", *snapshot, err)
+	}
+	g, err := hash.GetGroup(*group)
+	if err != nil {
+		return e.fail(exitError, "lookup: %s: %v", *group, err)
+	}
+
+	keys := fs.Args()
+	if len(keys) == 0 {
+		scanner := bufio.NewScanner(e.stdin)
+		for scanner.Scan() {
+			if key := strings.TrimSpace(scanner.Text()); key != "" {
+				keys = append(keys, key)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return e.fail(exitError, "lookup: %v", err)
+		}
+	}
+
+	code := exitOK
+	results := make([]lookupResult, 0, len(keys))
+	for _, key := range keys {
+		element, payload, err := g.Match(key)
+		result := lookupResult{Key: key, Element: element, Payload: payload}
+		if err != nil {
+			result.Error = err.Error()
+			code = exitFailure
+		}
+		results = append(results, result)
+	}
+
+	if *asJSON {
+		e.printJSON(results)
+		return code
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(e.stdout, "%s\terror: %s\n", r.Key, r.Error)
+		} else {
+			fmt.Fprintf(e.stdout, "%s\t%s\n", r.Key, r.Element)
+		}
+	}
+	return code
+}
+
+// selectGroups returns the named group, or all groups if name is empty
+func selectGroups(hash *chash.CHash, name string) ([]*chash.Group, error) {
+	if name == "" {
+		return hash.GetGroups(), nil
+	}
+	group, err := hash.GetGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	return []*chash.Group{group}, nil
+}
+
+// stats reports the ownership and distribution of the groups of a snapshot
+func stats(e *env, args []string) int {
+	fs := e.flags("stats")
+	snapshot := fs.String("snapshot", "", "snapshot file")
+	group := fs.String("group", "", "only report this group")
+	asJSON := fs.Bool("json", false, "write JSON output")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if *snapshot == "" {
+		return e.fail(exitError, "stats: -snapshot is required")
+	}
+	hash, err := loadSnapshot(*snapshot, chash.RestoreOptions{})
+	if err != nil {
+		return e.fail(exitError, "stats: %s: %v", *snapshot, err)
+	}
+	groups, err := selectGroups(hash, *group)
+	if err != nil {
+		return e.fail(exitError, "stats: %s: %v", *group, err)
+	}
+
+	reports := make([]chash.GroupStats, 0, len(groups))
+	for _, g := range groups {
+		reports = append(reports, g.Stats())
+	}
+	if *asJSON {
+		e.printJSON(reports)
+		return exitOK
+	}
+	for _, s := range reports {
+		fmt.Fprintf(e.stdout, "group %s: %d replicas, %d points, %d collisions, stddev %.4f, max/mean %.4f\n",
+			s.Name, s.Replicas, s.Points, s.Collisions, s.StdDev, s.MaxMeanRatio)
+		for _, es := range s.Elements {
+			fmt.Fprintf(e.stdout, "  %-24s %8.4f%% %6d points\n", es.Key, es.Ownership*100, es.Points)
+		}
+	}
+	return exitOK
+}
+
+// groupDiff is the change of a single group between two snapshots
+type groupDiff struct {
+	Name   string  `json:"name"`
+	Status string  `json:"status"`
+	Moved  float64 `json:"moved"`
+	Arcs   int     `json:"arcs"`
+}
+
+// diff reports the keyspace moved between two snapshots
+func diff(e *env, args []string) int {
+	fs := e.flags("diff")
+	group := fs.String("group", "", "only compare this group")
+	asJSON := fs.Bool("json", false, "write JSON output")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 2 {
+		return e.fail(exitError, "diff: expected two snapshot files")
+	}
+	from, err := loadSnapshot(fs.Arg(0), chash.RestoreOptions{})
+	if err != nil {
+		return e.fail(exitError, "diff: %s: %v", fs.Arg(0), err)
+	}
+	to, err := loadSnapshot(fs.Arg(1), chash.RestoreOptions{})
+	if err != nil {
+		return e.fail(exitError, "diff: %s: %v", fs.Arg(1), err)
+	}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, g := range append(from.GetGroups(), to.GetGroups()...) {
+		if !seen[g.Name] && (*group == "" || g.Name == *group) {
+			seen[g.Name] = true
+			names = append(names, g.Name)
+		}
+	}
+	sort.Strings(names)
+
+	code := exitOK
+	diffs := make([]groupDiff, 0, len(names))
+	for _, name := range names {
+		before, beforeErr := from.GetGroup(name)
+		after, afterErr := to.GetGroup(name)
+		d := groupDiff{Name: name, Status: "changed"}
+		switch {
+		case beforeErr != nil:
+			d.Status, before = "added", chash.NewGroup(name, after.NumberOfReplicas)
+		case afterErr != nil:
+			d.Status, after = "removed", chash.NewGroup(name, before.NumberOfReplicas)
+		}
+		rd := chash.Diff(before, after)
+		d.Moved, d.Arcs = rd.Moved, len(rd.Arcs)
+		if d.Status == "changed" && len(rd.Arcs) == 0 {
+			d.Status = "unchanged"
+		}
+		if d.Status != "unchanged" {
+			code = exitFailure
+		}
+		diffs = append(diffs, d)
+	}
+
+	if *asJSON {
+		e.printJSON(diffs)
+		return code
+	}
+	for _, d := range diffs {
+		fmt.Fprintf(e.stdout, "%s\t%s\t%.4f%% moved in %d arcs\n", d.Name, d.Status, d.Moved*100, d.Arcs)
+	}
+	return code
+}
+
+// convert writes a snapshot in another format
+func convert(e *env, args []string) int {
+	fs := e.flags("convert")
+	snapshot := fs.String("snapshot", "", "snapshot file")
+	to := fs.String("to", "", "output format: json, binary, nginx, haproxy or envoy")
+	group := fs.String("group", "", "group to export, required for nginx, haproxy and envoy")
+	hashKey := fs.String("hash-key", "", "hash key of the exported upstream")
+	out := fs.String("o", "", "output file, stdout if empty")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if *snapshot == "" || *to == "" {
+		return e.fail(exitError, "convert: -snapshot and -to are required")
+	}
+	hash, err := loadSnapshot(*snapshot, chash.RestoreOptions{})
+	if err != nil {
+		return e.fail(exitError, "convert: %s: %v", *snapshot, err)
+	}
+
+	var data []byte
+	switch *to {
+	case "json":
+		data, err = hash.Serialize()
+	case "binary":
+		data, err = hash.MarshalBinary()
+	case "nginx", "haproxy", "envoy":
+		if *group == "" {
+			return e.fail(exitError, "convert: -group is required for %s", *to)
+		}
+		g, getErr := hash.GetGroup(*group)
+		if getErr != nil {
+			return e.fail(exitError, "convert: %s: %v", *group, getErr)
+		}
+		var sb strings.Builder
+		opts := chash.ExportOptions{HashKey: *hashKey}
+		switch *to {
+		case "nginx":
+			err = chash.ExportNginx(&sb, g, opts)
+		case "haproxy":
+			err = chash.ExportHAProxy(&sb, g, opts)
+		default:
+			err = chash.ExportEnvoy(&sb, g, opts)
+		}
+		data = []byte(sb.String())
+	default:
+		return e.fail(exitError, "convert: unknown format %q", *to)
+	}
+	if err != nil {
+		return e.fail(exitFailure, "convert: %v", err)
+	}
+
+	if *out == "" {
+		e.stdout.Write(data)
+		return exitOK
+	}
+	if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		return e.fail(exitError, "convert: %v", err)
+	}
+	return exitOK
+}
+
+// validation is the result of validating a single snapshot file
+type validation struct {
+	File     string `json:"file"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+	Groups   int    `json:"groups"`
+	Elements int    `json:"elements"`
+}
+
+// validate checks snapshot files against the restore limits
+func validate(e *env, args []string) int {
+	fs := e.flags("validate")
+	maxGroups := fs.Int("max-groups", chash.DefaultMaxGroups, "largest number of groups, negative for no limit")
+	maxElements := fs.Int("max-elements", chash.DefaultMaxElements, "largest number of elements per group, negative for no limit")
+	maxReplicas := fs.Int("max-replicas", chash.DefaultMaxReplicas, "largest number of replicas, negative for no limit")
+	maxPoints := fs.Int("max-points", chash.DefaultMaxPoints, "largest number of virtual nodes per group, negative for no limit")
+	asJSON := fs.Bool("json", false, "write JSON output")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		return e.fail(exitError, "validate: expected at least one snapshot file")
+	}
+	opts := chash.RestoreOptions{MaxGroups: *maxGroups, MaxElements: *maxElements, MaxReplicas: *maxReplicas, MaxPoints: *maxPoints}
+
+	code := exitOK
+	results := make([]validation, 0, fs.NArg())
+	for _, file := range fs.Args() {
+		v := validation{File: file, Valid: true}
+		hash, err := loadSnapshot(file, opts)
+		if err != nil {
+			v.Valid, v.Error = false, err.Error()
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				code = exitError
+			} else if code == exitOK {
+				code = exitFailure
+			}
+		} else {
+			for _, g := range hash.GetGroups() {
+				v.Groups++
+				v.Elements += len(g.GetElements())
+			}
+		}
+		results = append(results, v)
+	}
+
+	if *asJSON {
+		e.printJSON(results)
+		return code
+	}
+	for _, v := range results {
+		if v.Valid {
+			fmt.Fprintf(e.stdout, "%s: ok, %d groups, %d elements\n", v.File, v.Groups, v.Elements)
+		} else {
+			fmt.Fprintf(e.stdout, "%s: invalid: %s\n", v.File, v.Error)
+		}
+	}
+	return code
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// simulate reports load imbalance, remapping and throughput for synthetic keys or a trace
+func simulate(e *env, args []string) int {
+	fs := e.flags("simulate")
+	dist := fs.String("dist", simulator.Uniform, "key distribution: uniform, zipf or sequential")
+	keys := fs.Int("keys", 100000, "number of keys, or the most keys read from a trace")
+	seed := fs.Int64("seed", 1, "seed of random key streams")
+	zipfS := fs.Float64("zipf-s", simulator.DefaultZipfS, "skew of the zipf distribution, greater than 1")
+	prefix := fs.String("prefix", "user-id-", "prefix of generated keys")
+	trace := fs.String("trace", "", "replay the keys of this file, one per line, - for stdin")
+	elements := fs.Int("elements", simulator.DefaultElements, "number of elements")
+	replicas := fs.String("replicas", strconv.Itoa(simulator.DefaultReplicas), "comma-separated numbers of replicas to compare")
+	algorithms := fs.String("algorithms", chash.AlgorithmRing, "comma-separated algorithms to compare")
+	hashers := fs.String("hashers", chash.HasherCRC32, "comma-separated hashers to compare")
+	asJSON := fs.Bool("json", false, "write JSON output")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg := simulator.Config{
+		Elements:   *elements,
+		Algorithms: splitList(*algorithms),
+		Hashers:    splitList(*hashers),
+	}
+	for _, item := range splitList(*replicas) {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return e.fail(exitError, "simulate: invalid replicas %q", item)
+		}
+		cfg.Replicas = append(cfg.Replicas, n)
+	}
+
+	var stream chash.KeyIterator
+	switch *trace {
+	case "":
+		var err error
+		stream, err = simulator.NewStream(simulator.StreamOptions{
+			Distribution: *dist,
+			Keys:         *keys,
+			Seed:         *seed,
+			ZipfS:        *zipfS,
+			Prefix:       *prefix,
+		})
+		if err != nil {
+			return e.fail(exitError, "simulate: %v", err)
+		}
+	case "-":
+		stream = simulator.NewTrace(e.stdin)
+	default:
+		f, err := os.Open(*trace)
+		if err != nil {
+			return e.fail(exitError, "simulate: %v", err)
+		}
+		defer f.Close()
+		stream = simulator.NewTrace(f)
+	}
+	collected, err := simulator.Collect(stream, *keys)
+	if err != nil {
+		return e.fail(exitError, "simulate: %v", err)
+	}
+
+	results, err := simulator.Run(collected, cfg)
+	if err != nil {
+		return e.fail(exitError, "simulate: %v", err)
+	}
+	if *asJSON {
+		e.printJSON(results)
+		return exitOK
+	}
+	for _, r := range results {
+		fmt.Fprintf(e.stdout, "%s/%s replicas=%d elements=%d keys=%d: load %d..%d, max/mean %.4f, stddev %.4f, %.0f lookups/s\n",
+			r.Algorithm, r.Hasher, r.Replicas, r.Elements, r.Keys, r.MinLoad, r.MaxLoad, r.MaxMeanRatio, r.StdDev, r.LookupsPerSecond)
+		for _, remap := range r.Remaps {
+			fmt.Fprintf(e.stdout, "  %-20s moved %6.2f%% (ideal %6.2f%%)\n", remap.Change, remap.MovedRatio*100, remap.IdealRatio*100)
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+	"github.com/werbenhu/chash/simulator"
+)
+
+// newHash creates a CHash with a db group of two elements and an empty redis group
+func newHash() *chash.CHash {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 100)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	db.Insert("192.168.1.101:3306", []byte("mysql1"))
+	hash.CreateGroup("redis", 100)
+	return hash
+}
+
+func TestLookup(t *testing.T) {
+	hash := newHash()
+	path := writeSnapshot(t, hash, false)
+	db, _ := hash.GetGroup("db")
+	first, _, _ := db.Match("user-id-1")
+	second, _, _ := db.Match("user-id-2")
+
+	code, stdout, _ := execute("", "lookup", "-snapshot", path, "-group", "db", "user-id-1", "user-id-2")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "user-id-1\t"+first+"\nuser-id-2\t"+second+"\n", stdout)
+
+	code, stdout, _ = execute("user-id-1\n\nuser-id-2\n", "lookup", "-json", "-snapshot", path, "-group", "db")
+	assert.Equal(t, exitOK, code)
+	var results []lookupResult
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &results))
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, first, results[0].Element)
+	assert.Equal(t, "mysql"+first[12:13], string(results[0].Payload))
+
+	code, stdout, _ = execute("", "lookup", "-snapshot", path, "-group", "redis", "user-id-1")
+	assert.Equal(t, exitFailure, code)
+	assert.Equal(t, "user-id-1\terror: no result matched\n", stdout)
+
+	code, _, stderr := execute("", "lookup", "-snapshot", path, "-group", "mongo", "user-id-1")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "group not found")
+	code, _, _ = execute("", "lookup", "-group", "db")
+	assert.Equal(t, exitError, code)
+}
+
+func TestStats(t *testing.T) {
+	path := writeSnapshot(t, newHash(), true)
+
+	code, stdout, _ := execute("", "stats", "-json", "-snapshot", path)
+	assert.Equal(t, exitOK, code)
+	var reports []chash.GroupStats
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &reports))
+	assert.Equal(t, 2, len(reports))
+	assert.Equal(t, "db", reports[0].Name)
+	assert.Equal(t, 2, len(reports[0].Elements))
+
+	code, stdout, _ = execute("", "stats", "-snapshot", path, "-group", "db")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "group db: 100 replicas")
+	assert.Contains(t, stdout, "192.168.1.101:3306")
+}
+
+func TestDiff(t *testing.T) {
+	hash := newHash()
+	before := writeSnapshot(t, hash, false)
+	db, _ := hash.GetGroup("db")
+	db.Insert("192.168.1.102:3306", nil)
+	hash.RemoveGroup("redis")
+	hash.CreateGroup("mongo", 10)
+	after := writeSnapshot(t, hash, true)
+
+	code, stdout, _ := execute("", "diff", "-json", before, after)
+	assert.Equal(t, exitFailure, code)
+	var diffs []groupDiff
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &diffs))
+	assert.Equal(t, 3, len(diffs))
+	assert.Equal(t, "db", diffs[0].Name)
+	assert.Equal(t, "changed", diffs[0].Status)
+	assert.True(t, diffs[0].Moved > 0.2 && diffs[0].Moved < 0.5)
+	assert.Equal(t, groupDiff{Name: "mongo", Status: "added"}, diffs[1])
+	assert.Equal(t, groupDiff{Name: "redis", Status: "removed"}, diffs[2])
+
+	code, stdout, _ = execute("", "diff", before, before)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "db\tunchanged\t0.0000% moved in 0 arcs\n")
+
+	code, _, _ = execute("", "diff", before)
+	assert.Equal(t, exitError, code)
+}
+
+func TestConvert(t *testing.T) {
+	hash := newHash()
+	path := writeSnapshot(t, hash, false)
+	out := filepath.Join(t.TempDir(), "snapshot.bin")
+
+	code, _, _ := execute("", "convert", "-snapshot", path, "-to", "binary", "-o", out)
+	assert.Equal(t, exitOK, code)
+	data, _ := ioutil.ReadFile(out)
+	expected, _ := hash.MarshalBinary()
+	assert.Equal(t, expected, data)
+
+	code, stdout, _ := execute("", "convert", "-snapshot", out, "-to", "json")
+	assert.Equal(t, exitOK, code)
+	expected, _ = hash.Serialize()
+	assert.Equal(t, string(expected), stdout)
+
+	code, stdout, _ = execute("", "convert", "-snapshot", out, "-to", "nginx", "-group", "db")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "server 192.168.1.100:3306;")
+
+	code, _, _ = execute("", "convert", "-snapshot", out, "-to", "haproxy")
+	assert.Equal(t, exitError, code)
+	code, _, _ = execute("", "convert", "-snapshot", out, "-to", "yaml")
+	assert.Equal(t, exitError, code)
+}
+
+func TestValidate(t *testing.T) {
+	valid := writeSnapshot(t, newHash(), false)
+	invalid := filepath.Join(t.TempDir(), "invalid")
+	ioutil.WriteFile(invalid, []byte(`{"db":{"name":"db","numberOfReplicas":0}}`), 0644)
+
+	code, stdout, _ := execute("", "validate", valid)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, valid+": ok, 2 groups, 2 elements\n", stdout)
+
+	code, stdout, _ = execute("", "validate", "-json", valid, invalid)
+	assert.Equal(t, exitFailure, code)
+	var results []validation
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &results))
+	assert.Equal(t, []validation{
+		{File: valid, Valid: true, Groups: 2, Elements: 2},
+		{File: invalid, Error: "invalid number of replicas"},
+	}, results)
+
+	code, _, _ = execute("", "validate", "-max-elements", "1", valid)
+	assert.Equal(t, exitFailure, code)
+	code, _, _ = execute("", "validate", "-max-points", "1", valid)
+	assert.Equal(t, exitFailure, code)
+	code, _, _ = execute("", "validate", invalid, filepath.Join(t.TempDir(), "missing"))
+	assert.Equal(t, exitError, code)
+}
+
+func TestSimulate(t *testing.T) {
+	code, stdout, _ := execute("", "simulate", "-json", "-dist", "sequential", "-keys", "1000", "-elements", "4", "-replicas", "10, 100")
+	assert.Equal(t, exitOK, code)
+	var results []simulator.Result
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &results))
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, 10, results[0].Replicas)
+	assert.Equal(t, 100, results[1].Replicas)
+	assert.Equal(t, 1000, results[1].Keys)
+
+	code, stdout, _ = execute("user-id-1\nuser-id-2\nuser-id-1\n", "simulate", "-trace", "-", "-elements", "2")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "ring/crc32 replicas=100 elements=2 keys=3:")
+	assert.Contains(t, stdout, "add element-2")
+
+	code, _, stderr := execute("", "simulate", "-hashers", "xxhash")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "unsupported hasher")
+	code, _, _ = execute("", "simulate", "-replicas", "many")
+	assert.Equal(t, exitError, code)
+}
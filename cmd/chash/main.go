@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+// Command chash inspects and converts snapshots written by CHash.Serialize
+// or CHash.MarshalBinary:
+//
+//	chash lookup   -snapshot FILE -group NAME [KEY...]   match keys, read from stdin if none are given
+//	chash stats    -snapshot FILE [-group NAME]          ownership and distribution report
+//	chash diff     [-group NAME] OLD NEW                 keyspace moved between two snapshots
+//	chash convert  -snapshot FILE -to FORMAT [-group NAME] [-o FILE]
+//	chash validate [-max-groups N] [-max-elements N] [-max-replicas N] [-max-points N] FILE...
+//	chash simulate [-dist uniform|zipf|sequential] [-keys N] [-trace FILE] [-elements N] [-replicas N,...]
+//
+// Every subcommand except convert, whose output is the converted snapshot or
+// config, accepts -json for machine-readable output. The exit code is
+// 0 on success, 1 when a lookup fails, snapshots differ or a snapshot is invalid,
+// and 2 on usage or I/O errors. simulate works without a snapshot, see package simulator.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/werbenhu/chash"
+)
+
+// Exit codes of the command
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitError   = 2
+)
+
+// usage describes the subcommands
+const usage = `usage: chash <command> [flags]
+
+commands:
+  lookup    match keys against a group of a snapshot
+  stats     report the ownership and distribution of groups
+  diff      compare two snapshots
+  convert   convert a snapshot to json, binary, nginx, haproxy or envoy
+  validate  check snapshots against restore limits
+  simulate  measure load imbalance, remapping and throughput for a key stream
+
+run "chash <command> -h" for the flags of a command
+`
+
+// command is a subcommand reading and writing through env
+type command func(env *env, args []string) int
+
+var commands = map[string]command{
+	"lookup":   lookup,
+	"stats":    stats,
+	"diff":     diff,
+	"convert":  convert,
+	"validate": validate,
+	"simulate": simulate,
+}
+
+// env holds the streams of a run, so commands can be tested without a process
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// fail reports an error and returns the given exit code
+func (e *env) fail(code int, format string, args ...interface{}) int {
+	fmt.Fprintf(e.stderr, "chash: "+format+"\n", args...)
+	return code
+}
+
+// printJSON writes v as indented JSON to stdout
+func (e *env) printJSON(v interface{}) {
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// flags creates the flag set of a subcommand, errors are written to stderr
+func (e *env) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("chash "+name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+// loadSnapshot restores a JSON or binary snapshot file into a new CHash
+func loadSnapshot(path string, opts chash.RestoreOptions) (*chash.CHash, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hash := chash.New()
+	if chash.IsBinarySnapshot(data) {
+		err = hash.RestoreBinaryWithOptions(data, opts)
+	} else {
+		err = hash.RestoreWithOptions(data, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// run executes the command line and returns the exit code
+func run(e *env, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(e.stderr, usage)
+		return exitError
+	}
+	if args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		fmt.Fprint(e.stdout, usage)
+		return exitOK
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "chash: unknown command %q\n\n%s", args[0], usage)
+		return exitError
+	}
+	return cmd(e, args[1:])
+}
+
+func main() {
+	os.Exit(run(&env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
+}
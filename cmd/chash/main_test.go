@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+// execute runs the command line with the given stdin and returns the exit code and output
+func execute(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(&env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}, args)
+	return code, stdout.String(), stderr.String()
+}
+
+// writeSnapshot writes a snapshot of the CHash to a temporary file
+func writeSnapshot(t *testing.T, hash *chash.CHash, binary bool) string {
+	var data []byte
+	var err error
+	if binary {
+		data, err = hash.MarshalBinary()
+	} else {
+		data, err = hash.Serialize()
+	}
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "snapshot")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	code, _, stderr := execute("")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "usage: chash")
+
+	code, stdout, _ := execute("", "help")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "validate")
+
+	code, _, stderr = execute("", "unknown")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, `unknown command "unknown"`)
+
+	code, _, _ = execute("", "lookup", "-h")
+	assert.Equal(t, exitOK, code)
+	code, _, _ = execute("", "lookup", "-bogus")
+	assert.Equal(t, exitError, code)
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	hash := chash.New()
+	hash.CreateGroup("db", 10)
+
+	for _, binary := range []bool{false, true} {
+		loaded, err := loadSnapshot(writeSnapshot(t, hash, binary), chash.RestoreOptions{})
+		assert.Nil(t, err)
+		_, err = loaded.GetGroup("db")
+		assert.Nil(t, err)
+	}
+
+	_, err := loadSnapshot(filepath.Join(t.TempDir(), "missing"), chash.RestoreOptions{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The only algorithm and hasher implemented by a Group: a ring of CRC32 points.
+const (
+	AlgorithmRing = "ring"
+	HasherCRC32   = "crc32"
+)
+
+// Config describes the desired groups and elements of a CHash
+type Config struct {
+	Groups []GroupConfig `json:"groups" yaml:"groups"`
+}
+
+// GroupConfig describes a single group. Algorithm and Hasher may be left empty,
+// otherwise they must be AlgorithmRing and HasherCRC32.
+type GroupConfig struct {
+	Name      string          `json:"name" yaml:"name"`
+	Algorithm string          `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Hasher    string          `json:"hasher,omitempty" yaml:"hasher,omitempty"`
+	Replicas  int             `json:"replicas" yaml:"replicas"`
+	Elements  []ElementConfig `json:"elements" yaml:"elements"`
+}
+
+// ElementConfig describes a single element of a group
+type ElementConfig struct {
+	Key     string `json:"key" yaml:"key"`
+	Payload string `json:"payload,omitempty" yaml:"payload,omitempty"`
+}
+
+// ConfigAction is the kind of change needed to reconcile a CHash with a Config
+type ConfigAction string
+
+const (
+	ActionCreateGroup ConfigAction = "create-group"
+	ActionRemoveGroup ConfigAction = "remove-group"
+	ActionSetReplicas ConfigAction = "set-replicas"
+	ActionInsert      ConfigAction = "insert"
+	ActionUpdate      ConfigAction = "update"
+	ActionDelete      ConfigAction = "delete"
+)
+
+// ConfigChange is a single change needed to reconcile a CHash with a Config
+type ConfigChange struct {
+	Action   ConfigAction `json:"action"`
+	Group    string       `json:"group"`
+	Key      string       `json:"key,omitempty"`
+	Payload  []byte       `json:"payload,omitempty"`
+	Replicas int          `json:"replicas,omitempty"`
+}
+
+// ParseConfig parses a JSON config document
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ParseYAMLConfig parses a YAML config document
+func ParseYAMLConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfig reads a config file. Files with a .yaml or .yml extension
+// are parsed as YAML, anything else as JSON.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAMLConfig(data)
+	default:
+		return ParseConfig(data)
+	}
+}
+
+// Validate checks that group names and element keys are unique and non-empty,
+// that replicas are positive and within DefaultMaxReplicas, that no group has more
+// than DefaultMaxPoints virtual nodes and that the algorithm and hasher are supported.
+func (cfg *Config) Validate() error {
+	names := make(map[string]bool)
+	for _, group := range cfg.Groups {
+		if group.Name == "" || names[group.Name] {
+			return ErrInvalidConfig
+		}
+		names[group.Name] = true
+
+		if group.Algorithm != "" && group.Algorithm != AlgorithmRing {
+			return ErrUnsupportedAlgorithm
+		}
+		if group.Hasher != "" && group.Hasher != HasherCRC32 {
+			return ErrUnsupportedHasher
+		}
+		if group.Replicas <= 0 || group.Replicas > DefaultMaxReplicas {
+			return ErrInvalidReplicas
+		}
+		if exceedsPoints(len(group.Elements), group.Replicas, DefaultMaxPoints) {
+			return ErrTooManyPoints
+		}
+
+		keys := make(map[string]bool)
+		for _, element := range group.Elements {
+			if element.Key == "" || keys[element.Key] {
+				return ErrInvalidConfig
+			}
+			keys[element.Key] = true
+		}
+	}
+	return nil
+}
+
+// diffGroup returns the changes needed to turn an existing group into the configured one
+func diffGroup(group *Group, cfg GroupConfig) []ConfigChange {
+	group.RLock()
+	defer group.RUnlock()
+
+	changes := make([]ConfigChange, 0)
+	if group.NumberOfReplicas != cfg.Replicas {
+		changes = append(changes, ConfigChange{Action: ActionSetReplicas, Group: cfg.Name, Replicas: cfg.Replicas})
+	}
+
+	wanted := make(map[string]bool)
+	for _, element := range cfg.Elements {
+		wanted[element.Key] = true
+		existing, ok := group.Elements[element.Key]
+		if !ok {
+			changes = append(changes, ConfigChange{Action: ActionInsert, Group: cfg.Name, Key: element.Key, Payload: []byte(element.Payload)})
+		} else if string(existing.Payload) != element.Payload {
+			changes = append(changes, ConfigChange{Action: ActionUpdate, Group: cfg.Name, Key: element.Key, Payload: []byte(element.Payload)})
+		}
+	}
+
+	removed := make([]string, 0)
+	for key := range group.Elements {
+		if !wanted[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		changes = append(changes, ConfigChange{Action: ActionDelete, Group: cfg.Name, Key: key})
+	}
+	return changes
+}
+
+// diffConfig returns the changes needed to reconcile the registry with cfg.
+// The caller must hold the CHash lock.
+func (c *CHash) diffConfig(cfg *Config) []ConfigChange {
+	changes := make([]ConfigChange, 0)
+	wanted := make(map[string]bool)
+	for _, groupCfg := range cfg.Groups {
+		wanted[groupCfg.Name] = true
+		if group, ok := c.groups[groupCfg.Name]; ok {
+			changes = append(changes, diffGroup(group, groupCfg)...)
+			continue
+		}
+		changes = append(changes, ConfigChange{Action: ActionCreateGroup, Group: groupCfg.Name, Replicas: groupCfg.Replicas})
+		for _, element := range groupCfg.Elements {
+			changes = append(changes, ConfigChange{Action: ActionInsert, Group: groupCfg.Name, Key: element.Key, Payload: []byte(element.Payload)})
+		}
+	}
+
+	removed := make([]string, 0)
+	for name := range c.groups {
+		if !wanted[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		changes = append(changes, ConfigChange{Action: ActionRemoveGroup, Group: name})
+	}
+	return changes
+}
+
+// DiffConfig returns the changes ApplyConfig would make, without applying them
+func (c *CHash) DiffConfig(cfg *Config) ([]ConfigChange, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c.RLock()
+	defer c.RUnlock()
+	return c.diffConfig(cfg), nil
+}
+
+// ApplyConfig reconciles the registry with cfg, touching only what differs,
+// and returns the changes it made. Groups that are not in cfg are removed.
+// Existing groups are updated in place, so *Group handles stay valid.
+func (c *CHash) ApplyConfig(cfg *Config) ([]ConfigChange, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	changes := c.diffConfig(cfg)
+	for _, change := range changes {
+		switch change.Action {
+		case ActionCreateGroup:
+			c.adopt(NewGroup(change.Group, change.Replicas))
+		case ActionRemoveGroup:
+			c.groups[change.Group].markRemoved()
+			delete(c.groups, change.Group)
+		case ActionSetReplicas:
+			c.groups[change.Group].setReplicas(change.Replicas)
+		case ActionInsert, ActionUpdate:
+			if err := c.groups[change.Group].Upsert(change.Key, change.Payload); err != nil {
+				return nil, err
+			}
+		case ActionDelete:
+			if err := c.groups[change.Group].Delete(change.Key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{"groups":[{"name":"db","algorithm":"ring","hasher":"crc32","replicas":100,"elements":[{"key":"192.168.1.100:3306","payload":"mysql0-info"}]}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, &Config{Groups: []GroupConfig{{
+		Name:      "db",
+		Algorithm: AlgorithmRing,
+		Hasher:    HasherCRC32,
+		Replicas:  100,
+		Elements:  []ElementConfig{{Key: "192.168.1.100:3306", Payload: "mysql0-info"}},
+	}}}, cfg)
+
+	_, err = ParseConfig([]byte(`{"groups":[`))
+	assert.NotNil(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	items := []struct {
+		cfg Config
+		err error
+	}{
+		{cfg: Config{}, err: nil},
+		{cfg: Config{Groups: []GroupConfig{{Name: "", Replicas: 1}}}, err: ErrInvalidConfig},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: 1}, {Name: "db", Replicas: 1}}}, err: ErrInvalidConfig},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: 0}}}, err: ErrInvalidReplicas},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: DefaultMaxReplicas + 1}}}, err: ErrInvalidReplicas},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: DefaultMaxReplicas, Elements: make([]ElementConfig, 11)}}}, err: ErrTooManyPoints},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: 1, Algorithm: "jump"}}}, err: ErrUnsupportedAlgorithm},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: 1, Hasher: "fnv"}}}, err: ErrUnsupportedHasher},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: 1, Elements: []ElementConfig{{Key: "a"}, {Key: "a"}}}}}, err: ErrInvalidConfig},
+		{cfg: Config{Groups: []GroupConfig{{Name: "db", Replicas: 1, Elements: []ElementConfig{{Key: ""}}}}}, err: ErrInvalidConfig},
+	}
+
+	for _, item := range items {
+		assert.Equal(t, item.err, item.cfg.Validate())
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "chash.json")
+	ioutil.WriteFile(jsonPath, []byte(`{"groups":[{"name":"db","replicas":100,"elements":[{"key":"a","payload":"1"}]}]}`), 0644)
+	cfg, err := LoadConfig(jsonPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "db", cfg.Groups[0].Name)
+
+	yamlPath := filepath.Join(dir, "chash.yaml")
+	ioutil.WriteFile(yamlPath, []byte("groups:\n  - name: db\n    replicas: 100\n    elements:\n      - key: a\n        payload: \"1\"\n"), 0644)
+	yamlCfg, err := LoadConfig(yamlPath)
+	assert.Nil(t, err)
+	assert.Equal(t, cfg, yamlCfg)
+
+	ioutil.WriteFile(yamlPath, []byte("groups:\n  - name: db\n    replica: 100\n"), 0644)
+	_, err = LoadConfig(yamlPath)
+	assert.NotNil(t, err)
+
+	_, err = LoadConfig(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+}
+
+func TestCHashApplyConfig(t *testing.T) {
+	hash := New()
+	db, _ := hash.CreateGroup("db", 100)
+	db.Insert("192.168.1.100:3306", []byte("mysql0-info"))
+	db.Insert("192.168.1.101:3306", []byte("mysql1-info"))
+	db.Insert("192.168.1.102:3306", []byte("mysql2-info"))
+	old, _ := hash.CreateGroup("old", 100)
+
+	cfg := &Config{Groups: []GroupConfig{
+		{
+			Name:     "db",
+			Replicas: 100,
+			Elements: []ElementConfig{
+				{Key: "192.168.1.100:3306", Payload: "mysql0-info"},
+				{Key: "192.168.1.101:3306", Payload: "mysql1-new"},
+				{Key: "192.168.1.103:3306", Payload: "mysql3-info"},
+			},
+		},
+		{
+			Name:     "redis",
+			Replicas: 50,
+			Elements: []ElementConfig{{Key: "192.168.1.100:6379", Payload: "redis0-info"}},
+		},
+	}}
+
+	expected := []ConfigChange{
+		{Action: ActionUpdate, Group: "db", Key: "192.168.1.101:3306", Payload: []byte("mysql1-new")},
+		{Action: ActionInsert, Group: "db", Key: "192.168.1.103:3306", Payload: []byte("mysql3-info")},
+		{Action: ActionDelete, Group: "db", Key: "192.168.1.102:3306"},
+		{Action: ActionCreateGroup, Group: "redis", Replicas: 50},
+		{Action: ActionInsert, Group: "redis", Key: "192.168.1.100:6379", Payload: []byte("redis0-info")},
+		{Action: ActionRemoveGroup, Group: "old"},
+	}
+
+	changes, err := hash.DiffConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, changes)
+	assert.Equal(t, 3, len(db.Elements))
+	assert.Equal(t, 2, len(hash.groups))
+
+	changes, err = hash.ApplyConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, changes)
+
+	existing, err := hash.GetGroup("db")
+	assert.Nil(t, err)
+	assert.True(t, existing == db)
+	assert.Equal(t, 3, len(db.Elements))
+	assert.Equal(t, []byte("mysql1-new"), db.Elements["192.168.1.101:3306"].Payload)
+	assert.Equal(t, 300, len(db.circle))
+
+	redis, err := hash.GetGroup("redis")
+	assert.Nil(t, err)
+	assert.Equal(t, 50, len(redis.circle))
+
+	_, _, err = old.Match("xxx")
+	assert.Equal(t, ErrGroupRemoved, err)
+
+	changes, err = hash.DiffConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changes))
+
+	cfg.Groups[0].Replicas = 10
+	changes, err = hash.ApplyConfig(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, []ConfigChange{{Action: ActionSetReplicas, Group: "db", Replicas: 10}}, changes)
+	assert.Equal(t, 10, db.NumberOfReplicas)
+	assert.Equal(t, 30, len(db.circle))
+
+	cfg.Groups[0].Hasher = "fnv"
+	_, err = hash.ApplyConfig(cfg)
+	assert.Equal(t, ErrUnsupportedHasher, err)
+	_, err = hash.DiffConfig(cfg)
+	assert.Equal(t, ErrUnsupportedHasher, err)
+}
+
+func TestSingletonApplyConfig(t *testing.T) {
+	singleton = nil
+	changes, err := ApplyConfig(&Config{Groups: []GroupConfig{{Name: "db", Replicas: 10}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(changes))
+
+	group, err := GetGroup("db")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, group.NumberOfReplicas)
+}
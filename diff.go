@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+// Arc is a range [Start, End) of the CRC32 keyspace whose owner changed.
+// End is at most 1<<32, which is why both bounds are uint64.
+// From or To is empty when the corresponding ring has no elements.
+type Arc struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// RingDiff describes how ownership of the keyspace changes between two rings
+type RingDiff struct {
+	// Arcs are the ranges whose owner changed, in ascending order.
+	Arcs []Arc `json:"arcs"`
+
+	// Moved is the fraction of the keyspace covered by Arcs.
+	Moved float64 `json:"moved"`
+}
+
+// Diff compares the circles of two groups and returns the arcs whose owner changed.
+// Each group is read under its own lock, so to evaluate a proposed change,
+// apply it to a Clone of the live group and diff the two.
+func Diff(from, to *Group) *RingDiff {
+	return diffRings(from.ring(), to.ring())
+}
+
+// diffRings compares two ring snapshots
+func diffRings(from, to ring) *RingDiff {
+	bounds := make(Circle, 0, len(from.points)+len(to.points))
+	bounds = append(bounds, from.points...)
+	bounds = append(bounds, to.points...)
+	bounds.Sort()
+
+	starts := make([]uint64, 0, len(bounds)+1)
+	if len(bounds) > 0 && bounds[0] != 0 {
+		starts = append(starts, 0)
+	}
+	for i, point := range bounds {
+		if i == 0 || bounds[i-1] != point {
+			starts = append(starts, uint64(point))
+		}
+	}
+
+	diff := &RingDiff{Arcs: make([]Arc, 0)}
+	moved := uint64(0)
+	for i, start := range starts {
+		end := keyspace
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		src, dst := from.owner(uint32(start)), to.owner(uint32(start))
+		if src == dst {
+			continue
+		}
+		moved += end - start
+
+		last := len(diff.Arcs) - 1
+		if last >= 0 && diff.Arcs[last].End == start && diff.Arcs[last].From == src && diff.Arcs[last].To == dst {
+			diff.Arcs[last].End = end
+			continue
+		}
+		diff.Arcs = append(diff.Arcs, Arc{Start: start, End: end, From: src, To: dst})
+	}
+	diff.Moved = float64(moved) / float64(keyspace)
+	return diff
+}
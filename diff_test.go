@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRings(t *testing.T) {
+	from := ring{points: Circle{10, 20}, owners: []string{"a", "b"}}
+	to := ring{points: Circle{10, 15, 20}, owners: []string{"a", "c", "b"}}
+
+	diff := diffRings(from, to)
+	assert.Equal(t, []Arc{{Start: 15, End: 20, From: "a", To: "c"}}, diff.Arcs)
+	assert.Equal(t, 5/float64(keyspace), diff.Moved)
+
+	diff = diffRings(to, from)
+	assert.Equal(t, []Arc{{Start: 15, End: 20, From: "c", To: "a"}}, diff.Arcs)
+
+	wrap := ring{points: Circle{5, 10, 20}, owners: []string{"c", "a", "b"}}
+	diff = diffRings(from, wrap)
+	assert.Equal(t, []Arc{{Start: 5, End: 10, From: "b", To: "c"}}, diff.Arcs)
+
+	tail := ring{points: Circle{10, 20, 100}, owners: []string{"a", "b", "c"}}
+	diff = diffRings(from, tail)
+	assert.Equal(t, []Arc{
+		{Start: 0, End: 10, From: "b", To: "c"},
+		{Start: 100, End: keyspace, From: "b", To: "c"},
+	}, diff.Arcs)
+	assert.Equal(t, float64(keyspace-90)/float64(keyspace), diff.Moved)
+
+	diff = diffRings(ring{}, from)
+	assert.Equal(t, []Arc{
+		{Start: 0, End: 10, From: "", To: "b"},
+		{Start: 10, End: 20, From: "", To: "a"},
+		{Start: 20, End: keyspace, From: "", To: "b"},
+	}, diff.Arcs)
+	assert.Equal(t, float64(1), diff.Moved)
+
+	diff = diffRings(ring{}, ring{})
+	assert.Equal(t, 0, len(diff.Arcs))
+	assert.Equal(t, float64(0), diff.Moved)
+}
+
+func TestDiff(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	group.Insert("192.168.1.101:1883", []byte("werbenhu101"))
+
+	diff := Diff(group, group)
+	assert.Equal(t, 0, len(diff.Arcs))
+
+	proposed := group.Clone()
+	proposed.Insert("192.168.1.102:1883", []byte("werbenhu102"))
+	assert.Equal(t, 2, len(group.Elements))
+
+	diff = Diff(group, proposed)
+	assert.NotEqual(t, 0, len(diff.Arcs))
+	for _, arc := range diff.Arcs {
+		assert.Equal(t, "192.168.1.102:1883", arc.To)
+		assert.NotEqual(t, "192.168.1.102:1883", arc.From)
+		assert.True(t, arc.Start < arc.End)
+	}
+	assert.InDelta(t, proposed.ring().ownership()["192.168.1.102:1883"], diff.Moved, 1e-9)
+
+	diff = Diff(proposed, group)
+	for _, arc := range diff.Arcs {
+		assert.Equal(t, "192.168.1.102:1883", arc.From)
+	}
+}
+
+func TestGroupClone(t *testing.T) {
+	hash := New()
+	group, _ := hash.CreateGroup("test", 100)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+
+	clone := group.Clone()
+	assert.Equal(t, group.Elements, clone.Elements)
+	assert.Equal(t, group.circle, clone.circle)
+	assert.Equal(t, group.rows, clone.rows)
+	assert.Nil(t, clone.owner)
+
+	clone.Insert("192.168.1.101:1883", []byte("werbenhu101"))
+	assert.Equal(t, 1, len(group.Elements))
+	assert.Equal(t, 100, len(group.circle))
+	assert.Equal(t, uint64(1), group.Version())
+}
@@ -26,8 +26,29 @@ func (e err) Error() string {
 // Several global variables that represent common errors that may be
 // returned by the CHash functions.
 var (
-	ErrGroupNotFound   = err{Code: 10000, Msg: "group not found"}
-	ErrGroupExisted    = err{Code: 10001, Msg: "group already existed"}
-	ErrNoResultMatched = err{Code: 10002, Msg: "no result matched"}
-	ErrKeyExisted      = err{Code: 10003, Msg: "key already existed"}
+	ErrGroupNotFound        = err{Code: 10000, Msg: "group not found"}
+	ErrGroupExisted         = err{Code: 10001, Msg: "group already existed"}
+	ErrNoResultMatched      = err{Code: 10002, Msg: "no result matched"}
+	ErrKeyExisted           = err{Code: 10003, Msg: "key already existed"}
+	ErrInvalidSnapshot      = err{Code: 10004, Msg: "invalid snapshot"}
+	ErrTooManyGroups        = err{Code: 10005, Msg: "too many groups"}
+	ErrTooManyElements      = err{Code: 10006, Msg: "too many elements"}
+	ErrInvalidReplicas      = err{Code: 10007, Msg: "invalid number of replicas"}
+	ErrGroupRemoved         = err{Code: 10008, Msg: "group removed"}
+	ErrInvalidConfig        = err{Code: 10009, Msg: "invalid config"}
+	ErrUnsupportedAlgorithm = err{Code: 10010, Msg: "unsupported algorithm"}
+	ErrUnsupportedHasher    = err{Code: 10011, Msg: "unsupported hasher"}
+	ErrInvalidAddress       = err{Code: 10012, Msg: "invalid address"}
+	ErrKeyNotFound          = err{Code: 10013, Msg: "key not found"}
+	ErrInvalidChange        = err{Code: 10014, Msg: "invalid change"}
+	ErrInvalidHealth        = err{Code: 10015, Msg: "invalid health"}
+	ErrNoHealthyElement     = err{Code: 10016, Msg: "no healthy element"}
+	ErrInvalidCapacity      = err{Code: 10017, Msg: "invalid capacity"}
+	ErrInvalidTTL           = err{Code: 10018, Msg: "invalid ttl"}
+	ErrNoLease              = err{Code: 10019, Msg: "no lease"}
+	ErrNotInstrumented      = err{Code: 10020, Msg: "instrumentation not enabled"}
+	ErrExpvarExisted        = err{Code: 10021, Msg: "expvar already existed"}
+	ErrInvalidNode          = err{Code: 10022, Msg: "invalid node"}
+	ErrInvalidMembership    = err{Code: 10023, Msg: "invalid membership"}
+	ErrTooManyPoints        = err{Code: 10024, Msg: "too many virtual nodes"}
 )
@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bufio"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default request properties hashed by the exported proxy configs.
+const (
+	DefaultNginxHashKey   = "$request_uri"
+	DefaultHAProxyHashKey = "path"
+)
+
+// maxEnvoyRingSize is the largest ring_hash ring Envoy accepts
+const maxEnvoyRingSize = 8388608
+
+// ExportOptions configures the proxy config exporters
+type ExportOptions struct {
+	// HashKey is the request property the proxy hashes to pick a server,
+	// e.g. "$cookie_user" for nginx or "req.hdr(x-user)" for HAProxy.
+	// It is not used by the Envoy exporter, where hashing is configured on the route.
+	HashKey string
+}
+
+// exportGroup is a consistent view of a group taken for exporting
+type exportGroup struct {
+	name     string
+	replicas int
+	keys     []string
+}
+
+// validToken reports whether s can be written into a proxy config unquoted
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	return !strings.ContainsAny(s, " \t\r\n;{}#\"'\\")
+}
+
+// snapshotExport reads the group name, replicas and sorted element keys under the group lock
+func snapshotExport(group *Group) (*exportGroup, error) {
+	group.RLock()
+	defer group.RUnlock()
+	if group.removed {
+		return nil, ErrGroupRemoved
+	}
+
+	eg := &exportGroup{name: group.Name, replicas: group.NumberOfReplicas}
+	if !validToken(eg.name) {
+		return nil, ErrInvalidAddress
+	}
+	for key := range group.Elements {
+		if !validToken(key) {
+			return nil, ErrInvalidAddress
+		}
+		eg.keys = append(eg.keys, key)
+	}
+	sort.Strings(eg.keys)
+	return eg, nil
+}
+
+// writeHeader writes the comment block shared by all exporters
+func writeHeader(w *bufio.Writer, eg *exportGroup, target string, notes []string) {
+	fmt.Fprintf(w, "# Generated by chash from group %q: %d elements, %d replicas per element.\n", eg.name, len(eg.keys), eg.replicas)
+	fmt.Fprintf(w, "#\n# WARNING: %s does NOT place keys the same way as chash.\n", target)
+	fmt.Fprintf(w, "#   - chash hashes keys with CRC32 and places %d points per element at CRC32(\"<index><element>\").\n", eg.replicas)
+	for _, note := range notes {
+		fmt.Fprintf(w, "#   - %s\n", note)
+	}
+	fmt.Fprintf(w, "# The same servers are used, but a key may be routed to a different server\n")
+	fmt.Fprintf(w, "# than Group.Match reports. Do not rely on both agreeing for data locality.\n\n")
+}
+
+// ExportNginx renders the group as an nginx upstream block using "hash ... consistent".
+// Element keys are used as server addresses.
+func ExportNginx(w io.Writer, group *Group, opts ExportOptions) error {
+	eg, err := snapshotExport(group)
+	if err != nil {
+		return err
+	}
+	hashKey := opts.HashKey
+	if hashKey == "" {
+		hashKey = DefaultNginxHashKey
+	}
+
+	bw := bufio.NewWriter(w)
+	writeHeader(bw, eg, "nginx", []string{
+		"nginx uses ketama: 160 points per unit of server weight, placed by CRC32 of the server address.",
+		"nginx ignores the chash replica count and payloads.",
+	})
+	fmt.Fprintf(bw, "upstream %s {\n", eg.name)
+	fmt.Fprintf(bw, "    hash %s consistent;\n", hashKey)
+	for _, key := range eg.keys {
+		fmt.Fprintf(bw, "    server %s;\n", key)
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// haproxyName turns an element key into an HAProxy server name,
+// replacing the characters HAProxy does not allow in names
+func haproxyName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-', r == '_', r == '.', r == ':':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// haproxyIDs assigns every key a positive server id derived from the CRC32 of the key,
+// so the ids of the other servers stay the same when an element is added or removed.
+// Colliding ids are resolved by probing the next id in sorted key order.
+func haproxyIDs(keys []string) map[string]uint32 {
+	const maxID = 1<<31 - 1
+	ids := make(map[string]uint32, len(keys))
+	taken := make(map[uint32]bool, len(keys))
+	for _, key := range keys {
+		id := crc32.ChecksumIEEE([]byte(key))%maxID + 1
+		for taken[id] {
+			id = id%maxID + 1
+		}
+		taken[id] = true
+		ids[key] = id
+	}
+	return ids
+}
+
+// ExportHAProxy renders the group as an HAProxy backend using "balance hash" and
+// "hash-type consistent". Element keys are used as server addresses, and as server
+// names with the characters HAProxy does not allow replaced by underscores.
+// Server ids are derived from the keys, so they are stable across exports.
+func ExportHAProxy(w io.Writer, group *Group, opts ExportOptions) error {
+	eg, err := snapshotExport(group)
+	if err != nil {
+		return err
+	}
+	hashKey := opts.HashKey
+	if hashKey == "" {
+		hashKey = DefaultHAProxyHashKey
+	}
+
+	bw := bufio.NewWriter(w)
+	writeHeader(bw, eg, "HAProxy", []string{
+		"HAProxy places servers by their numeric id and weight, and hashes keys with sdbm by default.",
+		"Server ids are derived from CRC32 of the element key, so adding or removing an element keeps the other ids.",
+		"HAProxy ignores the chash replica count and payloads.",
+	})
+	fmt.Fprintf(bw, "backend %s\n", eg.name)
+	fmt.Fprintf(bw, "    balance hash %s\n", hashKey)
+	fmt.Fprintf(bw, "    hash-type consistent\n")
+	ids := haproxyIDs(eg.keys)
+	names := make(map[string]bool, len(eg.keys))
+	for _, key := range eg.keys {
+		name := haproxyName(key)
+		if names[name] {
+			name += "_" + strconv.FormatUint(uint64(ids[key]), 10)
+		}
+		names[name] = true
+		fmt.Fprintf(bw, "    server %s %s id %d\n", name, key, ids[key])
+	}
+	return bw.Flush()
+}
+
+// ExportEnvoy renders the group as an Envoy cluster in YAML with a RING_HASH lb_policy.
+// Element keys must be "host:port" addresses.
+func ExportEnvoy(w io.Writer, group *Group, opts ExportOptions) error {
+	eg, err := snapshotExport(group)
+	if err != nil {
+		return err
+	}
+
+	type endpoint struct {
+		host string
+		port int
+	}
+	endpoints := make([]endpoint, 0, len(eg.keys))
+	clusterType := "STATIC"
+	for _, key := range eg.keys {
+		host, port, err := net.SplitHostPort(key)
+		if err != nil {
+			return ErrInvalidAddress
+		}
+		portValue, err := strconv.Atoi(port)
+		if err != nil || portValue <= 0 || portValue > 65535 {
+			return ErrInvalidAddress
+		}
+		if net.ParseIP(host) == nil {
+			clusterType = "STRICT_DNS"
+		}
+		endpoints = append(endpoints, endpoint{host: host, port: portValue})
+	}
+
+	ringSize := len(eg.keys) * eg.replicas
+	if ringSize > maxEnvoyRingSize {
+		ringSize = maxEnvoyRingSize
+	}
+	if ringSize == 0 {
+		ringSize = 1
+	}
+
+	bw := bufio.NewWriter(w)
+	writeHeader(bw, eg, "Envoy", []string{
+		"Envoy ring_hash hashes hosts and keys with xxHash64 and spreads the ring size over hosts by weight.",
+		"Keys are hashed by the route's hash_policy, which is not part of this cluster.",
+	})
+	fmt.Fprintf(bw, "name: %s\n", strconv.Quote(eg.name))
+	fmt.Fprintf(bw, "connect_timeout: 1s\n")
+	fmt.Fprintf(bw, "type: %s\n", clusterType)
+	fmt.Fprintf(bw, "lb_policy: RING_HASH\n")
+	fmt.Fprintf(bw, "ring_hash_lb_config:\n")
+	fmt.Fprintf(bw, "  hash_function: XX_HASH\n")
+	fmt.Fprintf(bw, "  minimum_ring_size: %d\n", ringSize)
+	fmt.Fprintf(bw, "  maximum_ring_size: %d\n", ringSize)
+	fmt.Fprintf(bw, "load_assignment:\n")
+	fmt.Fprintf(bw, "  cluster_name: %s\n", strconv.Quote(eg.name))
+	fmt.Fprintf(bw, "  endpoints:\n")
+	if len(endpoints) == 0 {
+		fmt.Fprintf(bw, "  - lb_endpoints: []\n")
+	} else {
+		fmt.Fprintf(bw, "  - lb_endpoints:\n")
+	}
+	for _, ep := range endpoints {
+		fmt.Fprintf(bw, "    - endpoint:\n")
+		fmt.Fprintf(bw, "        address:\n")
+		fmt.Fprintf(bw, "          socket_address:\n")
+		fmt.Fprintf(bw, "            address: %s\n", strconv.Quote(ep.host))
+		fmt.Fprintf(bw, "            port_value: %d\n", ep.port)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bytes"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func newExportGroup() *Group {
+	group := NewGroup("db", 100)
+	group.Insert("192.168.1.101:3306", []byte("mysql1-info"))
+	group.Insert("192.168.1.100:3306", []byte("mysql0-info"))
+	return group
+}
+
+func TestExportNginx(t *testing.T) {
+	var buf bytes.Buffer
+	err := ExportNginx(&buf, newExportGroup(), ExportOptions{})
+	assert.Nil(t, err)
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "# Generated by chash from group \"db\": 2 elements, 100 replicas per element.\n"))
+	assert.Contains(t, out, "# WARNING: nginx does NOT place keys the same way as chash.\n")
+	assert.Contains(t, out, "upstream db {\n    hash $request_uri consistent;\n    server 192.168.1.100:3306;\n    server 192.168.1.101:3306;\n}\n")
+
+	buf.Reset()
+	err = ExportNginx(&buf, newExportGroup(), ExportOptions{HashKey: "$cookie_user"})
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "    hash $cookie_user consistent;\n")
+}
+
+func TestExportHAProxy(t *testing.T) {
+	var buf bytes.Buffer
+	err := ExportHAProxy(&buf, newExportGroup(), ExportOptions{})
+	assert.Nil(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "# WARNING: HAProxy does NOT place keys the same way as chash.\n")
+	assert.Contains(t, out, "backend db\n    balance hash path\n    hash-type consistent\n"+
+		"    server 192.168.1.100:3306 192.168.1.100:3306 id 1892600144\n"+
+		"    server 192.168.1.101:3306 192.168.1.101:3306 id 999430892\n")
+
+	// adding an element keeps the ids of the existing servers
+	group := newExportGroup()
+	group.Insert("192.168.1.099:3306", nil)
+	buf.Reset()
+	assert.Nil(t, ExportHAProxy(&buf, group, ExportOptions{}))
+	assert.Contains(t, buf.String(), "    server 192.168.1.100:3306 192.168.1.100:3306 id 1892600144\n")
+	assert.Contains(t, buf.String(), "    server 192.168.1.101:3306 192.168.1.101:3306 id 999430892\n")
+
+	group = NewGroup("web", 10)
+	group.Insert("web/0:80", nil)
+	group.Insert("web@0:80", nil)
+	buf.Reset()
+	assert.Nil(t, ExportHAProxy(&buf, group, ExportOptions{}))
+	assert.Contains(t, buf.String(), "    server web_0:80 web/0:80 id ")
+	assert.Contains(t, buf.String(), "    server web_0:80_")
+}
+
+func TestHAProxyIDs(t *testing.T) {
+	// "plumless" and "buckeroo" have the same CRC32, the larger key probes the next id
+	ids := haproxyIDs([]string{"buckeroo", "plumless"})
+	assert.Equal(t, ids["buckeroo"]+1, ids["plumless"])
+	assert.Equal(t, crc32.ChecksumIEEE([]byte("buckeroo"))%(1<<31-1)+1, ids["buckeroo"])
+}
+
+func TestExportEnvoy(t *testing.T) {
+	var buf bytes.Buffer
+	err := ExportEnvoy(&buf, newExportGroup(), ExportOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "# WARNING: Envoy does NOT place keys the same way as chash.\n")
+
+	cluster := make(map[string]interface{})
+	err = yaml.Unmarshal(buf.Bytes(), &cluster)
+	assert.Nil(t, err)
+	assert.Equal(t, "db", cluster["name"])
+	assert.Equal(t, "STATIC", cluster["type"])
+	assert.Equal(t, "RING_HASH", cluster["lb_policy"])
+	assert.Contains(t, buf.String(), "  minimum_ring_size: 200\n")
+	assert.Contains(t, buf.String(), "            address: \"192.168.1.100\"\n            port_value: 3306\n")
+
+	group := NewGroup("web", 10)
+	group.Insert("web0.local:80", nil)
+	buf.Reset()
+	err = ExportEnvoy(&buf, group, ExportOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), "type: STRICT_DNS\n")
+
+	group = NewGroup("empty", 10)
+	buf.Reset()
+	err = ExportEnvoy(&buf, group, ExportOptions{})
+	assert.Nil(t, err)
+	err = yaml.Unmarshal(buf.Bytes(), &cluster)
+	assert.Nil(t, err)
+}
+
+func TestExportInvalidAddress(t *testing.T) {
+	var buf bytes.Buffer
+	group := NewGroup("db", 10)
+	group.Insert("192.168.1.100", nil)
+	assert.Nil(t, ExportNginx(&buf, group, ExportOptions{}))
+	assert.Equal(t, ErrInvalidAddress, ExportEnvoy(&buf, group, ExportOptions{}))
+
+	group.Insert("bad; server", nil)
+	assert.Equal(t, ErrInvalidAddress, ExportNginx(&buf, group, ExportOptions{}))
+	assert.Equal(t, ErrInvalidAddress, ExportHAProxy(&buf, group, ExportOptions{}))
+
+	group = NewGroup("bad name", 10)
+	assert.Equal(t, ErrInvalidAddress, ExportNginx(&buf, group, ExportOptions{}))
+
+	hash := New()
+	group, _ = hash.CreateGroup("db", 10)
+	hash.RemoveGroup("db")
+	assert.Equal(t, ErrGroupRemoved, ExportNginx(&buf, group, ExportOptions{}))
+}
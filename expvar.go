@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+)
+
+// ExpvarOptions controls what PublishExpvar exposes
+type ExpvarOptions struct {
+	// IncludePayloads adds the payload of every element. Payloads often hold
+	// addresses or credentials, so they are left out by default.
+	IncludePayloads bool
+}
+
+// expvarElement is an element as shown under expvar
+type expvarElement struct {
+	Key     string `json:"key"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// expvarGroup is a group as shown under expvar
+type expvarGroup struct {
+	Replicas int             `json:"replicas"`
+	Points   int             `json:"points"`
+	Version  uint64          `json:"version"`
+	Elements []expvarElement `json:"elements"`
+}
+
+// expvarState is a CHash as shown under expvar
+type expvarState struct {
+	Version uint64                 `json:"version"`
+	Groups  map[string]expvarGroup `json:"groups"`
+}
+
+// expvarMu serializes checking and publishing expvar names, as expvar.Publish
+// panics on duplicates
+var expvarMu sync.Mutex
+
+// expvarValue reads the group under the group lock
+func (b *Group) expvarValue(opts ExpvarOptions) expvarGroup {
+	b.RLock()
+	defer b.RUnlock()
+	g := expvarGroup{
+		Replicas: b.NumberOfReplicas,
+		Points:   len(b.snapshotRing().points),
+		Version:  b.hub.current(),
+		Elements: make([]expvarElement, 0, len(b.Elements)),
+	}
+	for key, element := range b.Elements {
+		e := expvarElement{Key: key}
+		if opts.IncludePayloads {
+			e.Payload = element.Payload
+		}
+		g.Elements = append(g.Elements, e)
+	}
+	sort.Slice(g.Elements, func(i, j int) bool {
+		return g.Elements[i].Key < g.Elements[j].Key
+	})
+	return g
+}
+
+// expvarValue reads the state of the CHash and all its groups
+func (c *CHash) expvarValue(opts ExpvarOptions) expvarState {
+	state := expvarState{
+		Version: c.Version(),
+		Groups:  make(map[string]expvarGroup),
+	}
+	for _, group := range c.GetGroups() {
+		state.Groups[group.Name] = group.expvarValue(opts)
+	}
+	return state
+}
+
+// publishExpvar publishes a lazily computed variable unless the name is taken
+func publishExpvar(name string, fn func() interface{}) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if expvar.Get(name) != nil {
+		return ErrExpvarExisted
+	}
+	expvar.Publish(name, expvar.Func(fn))
+	return nil
+}
+
+// PublishExpvar publishes the groups, element keys, replicas, ring sizes and
+// versions of the CHash under the given expvar name, e.g. for /debug/vars.
+// The state is computed on every read of the variable. expvar cannot unpublish
+// a name, so it stays published for the life of the process.
+func (c *CHash) PublishExpvar(name string, opts ExpvarOptions) error {
+	return publishExpvar(name, func() interface{} {
+		return c.expvarValue(opts)
+	})
+}
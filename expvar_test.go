@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// expvarNames numbers the published test variables, as expvar names stay taken
+// for the life of the process and tests may run more than once
+var expvarNames uint64
+
+func expvarName(prefix string) string {
+	return prefix + strconv.FormatUint(atomic.AddUint64(&expvarNames, 1), 10)
+}
+
+func TestCHashPublishExpvar(t *testing.T) {
+	hash := New()
+	name := expvarName("chash_test_state")
+	assert.Nil(t, hash.PublishExpvar(name, ExpvarOptions{}))
+	assert.Equal(t, ErrExpvarExisted, hash.PublishExpvar(name, ExpvarOptions{}))
+
+	group, _ := hash.CreateGroup("test", 10)
+	group.Insert("192.168.1.100:1883", []byte("secret"))
+
+	var state expvarState
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &state))
+	assert.Equal(t, uint64(2), state.Version)
+	assert.Equal(t, expvarGroup{
+		Replicas: 10,
+		Points:   10,
+		Version:  1,
+		Elements: []expvarElement{{Key: "192.168.1.100:1883"}},
+	}, state.Groups["test"])
+
+	group.Insert("192.168.1.101:1883", nil)
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &state))
+	assert.Equal(t, 2, len(state.Groups["test"].Elements))
+}
+
+func TestCHashPublishExpvarPayloads(t *testing.T) {
+	hash := New()
+	group, _ := hash.CreateGroup("test", 10)
+	group.Insert("192.168.1.100:1883", []byte("secret"))
+	name := expvarName("chash_test_payloads")
+	assert.Nil(t, hash.PublishExpvar(name, ExpvarOptions{IncludePayloads: true}))
+
+	var state expvarState
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &state))
+	assert.Equal(t, []byte("secret"), state.Groups["test"].Elements[0].Payload)
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+)
+
+// fingerprintVersion starts every digest, so a change of the layout changes all fingerprints
+const fingerprintVersion = 1
+
+// digest hashes length-prefixed fields, so no two different inputs are written the same way
+type digest struct {
+	hash    hash.Hash
+	scratch [binary.MaxVarintLen64]byte
+}
+
+// newDigest starts a digest
+func newDigest() *digest {
+	d := &digest{hash: sha256.New()}
+	d.uvarint(fingerprintVersion)
+	return d
+}
+
+// uvarint hashes an unsigned integer
+func (d *digest) uvarint(n uint64) {
+	d.hash.Write(d.scratch[:binary.PutUvarint(d.scratch[:], n)])
+}
+
+// bytes hashes a length-prefixed byte slice
+func (d *digest) bytes(b []byte) {
+	d.uvarint(uint64(len(b)))
+	d.hash.Write(b)
+}
+
+// sum returns the first 128 bits of the digest as 32 hex characters
+func (d *digest) sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil)[:16])
+}
+
+// writeFingerprint hashes the placement of the group under the group lock
+func (b *Group) writeFingerprint(d *digest) {
+	b.RLock()
+	defer b.RUnlock()
+	keys := make([]string, 0, len(b.Elements))
+	for key := range b.Elements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	d.bytes([]byte(AlgorithmRing))
+	d.bytes([]byte(HasherCRC32))
+	d.uvarint(uint64(b.NumberOfReplicas))
+	d.uvarint(uint64(len(keys)))
+	for _, key := range keys {
+		d.bytes([]byte(key))
+		d.bytes(b.Elements[key].Payload)
+	}
+}
+
+// Fingerprint returns a digest of everything that decides where the group
+// places keys and what Match returns: the algorithm, the hasher, the number of
+// replicas and the sorted keys and payloads of the elements.
+//
+// Groups with the same fingerprint match every key to the same element and payload,
+// however and in whatever order their elements were inserted, because a point
+// shared by several elements always belongs to the smallest key. Two processes
+// can therefore compare their rings by exchanging 32 hex characters. The name of the group
+// is not included, nor are health states, leases and sticky assignments.
+func (b *Group) Fingerprint() string {
+	d := newDigest()
+	b.writeFingerprint(d)
+	return d.sum()
+}
+
+// Fingerprint returns a digest of the names and Group fingerprints of all groups,
+// in sorted order of the names. Like Group.Fingerprint it does not depend on
+// the order groups and elements were added in.
+func (c *CHash) Fingerprint() string {
+	c.RLock()
+	defer c.RUnlock()
+	d := newDigest()
+	d.uvarint(uint64(len(c.groups)))
+	for _, name := range sortedNames(c.groups) {
+		d.bytes([]byte(name))
+		c.groups[name].writeFingerprint(d)
+	}
+	return d.sum()
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupFingerprint(t *testing.T) {
+	group := NewGroup("db", 100)
+	group.Insert("192.168.1.100:3306", []byte("mysql0"))
+	group.Insert("192.168.1.101:3306", []byte("mysql1"))
+	fingerprint := group.Fingerprint()
+	assert.Equal(t, 32, len(fingerprint))
+	assert.Equal(t, fingerprint, group.Fingerprint())
+
+	reversed := NewGroup("other", 100)
+	reversed.Insert("192.168.1.101:3306", []byte("mysql1"))
+	reversed.Insert("192.168.1.102:3306", nil)
+	reversed.Insert("192.168.1.100:3306", []byte("mysql0"))
+	reversed.Delete("192.168.1.102:3306")
+	assert.Equal(t, fingerprint, reversed.Fingerprint())
+	assert.Equal(t, fingerprint, group.Clone().Fingerprint())
+
+	reversed.Upsert("192.168.1.100:3306", []byte("mysql2"))
+	assert.NotEqual(t, fingerprint, reversed.Fingerprint())
+	reversed.Upsert("192.168.1.100:3306", []byte("mysql0"))
+	assert.Equal(t, fingerprint, reversed.Fingerprint())
+
+	replicas := group.Clone()
+	replicas.setReplicas(10)
+	assert.NotEqual(t, fingerprint, replicas.Fingerprint())
+
+	// keys and payloads are length-prefixed, so moving bytes between them changes the fingerprint
+	a := NewGroup("a", 1)
+	a.Insert("ab", []byte("c"))
+	b := NewGroup("b", 1)
+	b.Insert("a", []byte("bc"))
+	assert.NotEqual(t, a.Fingerprint(), b.Fingerprint())
+
+	assert.NotEqual(t, NewGroup("a", 1).Fingerprint(), NewGroup("a", 2).Fingerprint())
+}
+
+func TestGroupCollisionOrder(t *testing.T) {
+	// the 8th virtual node of node-9995 and the 1st of node-1884240 share a point
+	const a, b = "node-9995", "node-1884240"
+	point := crc32.ChecksumIEEE([]byte("7" + a))
+	assert.Equal(t, point, crc32.ChecksumIEEE([]byte("0"+b)))
+
+	forward := NewGroup("db", 10)
+	forward.Insert(a, nil)
+	forward.Insert(b, nil)
+	backward := NewGroup("db", 10)
+	backward.Insert(b, nil)
+	backward.Insert(a, nil)
+	rebuilt := forward.Clone()
+	rebuilt.rehash()
+
+	assert.Equal(t, forward.Fingerprint(), backward.Fingerprint())
+	for _, group := range []*Group{forward, backward, rebuilt} {
+		assert.Equal(t, 20, len(group.circle))
+		assert.Equal(t, b, group.rows[point].Key)
+		assert.Equal(t, forward.snapshotRing(), group.snapshotRing())
+	}
+
+	// the remaining element takes the shared point back
+	forward.Delete(b)
+	backward.Upsert(b, []byte("payload"))
+	backward.Delete(b)
+	only := NewGroup("db", 10)
+	only.Insert(a, nil)
+	for _, group := range []*Group{forward, backward} {
+		assert.Equal(t, a, group.rows[point].Key)
+		assert.Equal(t, only.circle, group.circle)
+		assert.Equal(t, only.snapshotRing(), group.snapshotRing())
+	}
+}
+
+func TestCHashFingerprint(t *testing.T) {
+	hash := New()
+	empty := hash.Fingerprint()
+	hash.CreateGroup("db", 10)
+	hash.CreateGroup("redis", 10)
+	hash.Insert("db", "192.168.1.100:3306", nil)
+	fingerprint := hash.Fingerprint()
+	assert.NotEqual(t, empty, fingerprint)
+
+	other := New()
+	other.CreateGroup("redis", 10)
+	other.CreateGroup("db", 10)
+	other.Insert("db", "192.168.1.100:3306", nil)
+	assert.Equal(t, fingerprint, other.Fingerprint())
+
+	data, _ := hash.Serialize()
+	restored := New()
+	assert.Nil(t, restored.Restore(data))
+	assert.Equal(t, fingerprint, restored.Fingerprint())
+	data, _ = hash.MarshalBinary()
+	restored = New()
+	assert.Nil(t, restored.RestoreBinary(data))
+	assert.Equal(t, fingerprint, restored.Fingerprint())
+
+	renamed := New()
+	renamed.CreateGroup("db", 10)
+	renamed.CreateGroup("memcached", 10)
+	renamed.Insert("db", "192.168.1.100:3306", nil)
+	assert.NotEqual(t, fingerprint, renamed.Fingerprint())
+}
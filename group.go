@@ -5,7 +5,9 @@
 package chash
 
 import (
+	"encoding/json"
 	"hash/crc32"
+	"sort"
 	"strconv"
 	"sync"
 )
@@ -23,8 +25,23 @@ type Group struct {
 	NumberOfReplicas int                 `json:"numberOfReplicas"`
 	Elements         map[string]*Element `json:"elements"`
 
-	circle Circle
-	rows   map[uint32]*Element
+	circle  Circle
+	rows    map[uint32]*Element
+	removed bool
+	health  map[string]Health
+	sticky  *stickyTable
+	leases  map[string]lease
+	clock   Clock
+	hub     hub
+	owner   *hub
+
+	// matches counts the Match results of each element, mutations the changes
+	// of the group by event type. Both are exposed as metrics.
+	matches   map[string]*uint64
+	mutations map[EventType]uint64
+
+	// hot tracks the most frequent lookup keys when instrumentation is enabled
+	hot *hotKeys
 }
 
 // NewGroup creates a new cache group with the given name and number of replicas
@@ -66,36 +83,160 @@ func (b *Group) virtualKey(key string, idx int) string {
 	return strconv.Itoa(idx) + key
 }
 
-// hashElement hashes the given element and adds it to the circle and rows maps
-func (b *Group) hashElement(element *Element) {
+// placeElement adds the virtual nodes of the given element to the circle and rows maps
+// without sorting the circle. A point shared by the virtual nodes of several elements
+// is owned by the element with the smallest key, whatever order they were placed in.
+func (b *Group) placeElement(element *Element) {
+	if b.matches == nil {
+		b.matches = make(map[string]*uint64)
+	}
+	if _, ok := b.matches[element.Key]; !ok {
+		b.matches[element.Key] = new(uint64)
+	}
 	for i := 0; i < b.NumberOfReplicas; i++ {
 		virtualKey := b.virtualKey(element.Key, i)
 		crc := b.hash(virtualKey)
-		b.rows[crc] = element
+		if owner, ok := b.rows[crc]; !ok || element.Key <= owner.Key {
+			b.rows[crc] = element
+		}
 		b.circle = append(b.circle, crc)
 	}
+}
+
+// hashElement hashes the given element and adds it to the circle and rows maps
+func (b *Group) hashElement(element *Element) {
+	b.placeElement(element)
 	b.circle.Sort()
 }
 
+// rehash rebuilds the circle and rows maps from the group's elements
+func (b *Group) rehash() {
+	b.circle = make(Circle, 0, len(b.Elements)*b.NumberOfReplicas)
+	b.rows = make(map[uint32]*Element, len(b.Elements)*b.NumberOfReplicas)
+	keys := make([]string, 0, len(b.Elements))
+	for key := range b.Elements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.placeElement(b.Elements[key])
+	}
+	b.circle.Sort()
+}
+
+// setReplicas changes the number of replicas and rebuilds the circle
+func (b *Group) setReplicas(replicas int) {
+	b.Lock()
+	defer b.Unlock()
+	b.NumberOfReplicas = replicas
+	b.rehash()
+	b.emit(ReplicasChanged, "", nil)
+}
+
+// replaceWith takes over the elements and circle of another group in place,
+// so existing handles to b observe the new state
+func (b *Group) replaceWith(other *Group) {
+	b.Lock()
+	defer b.Unlock()
+	b.NumberOfReplicas = other.NumberOfReplicas
+	b.Elements = other.Elements
+	b.circle = other.circle
+	b.rows = other.rows
+	b.removed = false
+	for key, counter := range b.matches {
+		if _, ok := b.Elements[key]; ok {
+			other.matches[key] = counter
+		} else if b.hot != nil {
+			b.hot.forget(key)
+		}
+	}
+	b.matches = other.matches
+	for key := range b.health {
+		if _, ok := b.Elements[key]; !ok {
+			delete(b.health, key)
+		}
+	}
+	for key := range b.leases {
+		if _, ok := b.Elements[key]; !ok {
+			delete(b.leases, key)
+		}
+	}
+	if b.sticky != nil {
+		b.sticky.retain(b.Elements)
+	}
+	b.emit(Restored, "", nil)
+}
+
+// markRemoved marks a group that is no longer part of a registry and drops its elements,
+// so its methods return ErrGroupRemoved instead of serving stale data
+func (b *Group) markRemoved() {
+	b.Lock()
+	defer b.Unlock()
+	b.removed = true
+	b.Elements = make(map[string]*Element)
+	b.circle = make(Circle, 0)
+	b.rows = make(map[uint32]*Element)
+	b.health = nil
+	b.sticky = nil
+	b.leases = nil
+	b.hot = nil
+	b.emit(GroupRemoved, "", nil)
+	b.owner = nil
+	b.hub.closeAll()
+}
+
 // Upsert adds or updates an element in the group
 func (b *Group) Upsert(key string, payload []byte) error {
-	element := &Element{Key: key, Payload: payload}
 	b.Lock()
 	defer b.Unlock()
-	if _, ok := b.Elements[element.Key]; ok {
-		b.delete(key)
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	b.upsert(key, payload)
+	return nil
+}
 
+// Add adds or updates an element like Upsert and reports whether it was added
+func (b *Group) Add(key string, payload []byte) (bool, error) {
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return false, ErrGroupRemoved
+	}
+	return !b.upsert(key, payload), nil
+}
+
+// upsert adds or updates an element and reports whether it existed,
+// the caller must hold the group lock
+func (b *Group) upsert(key string, payload []byte) bool {
+	element := &Element{Key: key, Payload: payload}
+	_, existed := b.Elements[element.Key]
+	if existed {
+		b.delete(key)
 	}
 	b.Elements[element.Key] = element
 	b.hashElement(element)
-	return nil
+	if existed {
+		b.emit(PayloadUpdated, key, payload)
+	} else {
+		b.emit(ElementAdded, key, payload)
+	}
+	return existed
 }
 
 // Insert adds a new element to the group
 func (b *Group) Insert(key string, payload []byte) error {
-	element := &Element{Key: key, Payload: payload}
 	b.Lock()
 	defer b.Unlock()
+	return b.insert(key, payload)
+}
+
+// insert adds a new element, the caller must hold the group lock
+func (b *Group) insert(key string, payload []byte) error {
+	element := &Element{Key: key, Payload: payload}
+	if b.removed {
+		return ErrGroupRemoved
+	}
 
 	if _, ok := b.Elements[element.Key]; ok {
 		return ErrKeyExisted
@@ -103,6 +244,7 @@ func (b *Group) Insert(key string, payload []byte) error {
 
 	b.Elements[element.Key] = element
 	b.hashElement(element)
+	b.emit(ElementAdded, key, payload)
 	return nil
 }
 
@@ -110,37 +252,143 @@ func (b *Group) Insert(key string, payload []byte) error {
 func (b *Group) delete(key string) {
 	element := &Element{Key: key, Payload: nil}
 	delete(b.Elements, element.Key)
+	shared := false
 	for i := 0; i < b.NumberOfReplicas; i++ {
 		virtualKey := b.virtualKey(key, i)
 		crc := b.hash(virtualKey)
-		delete(b.rows, crc)
-
 		if val, ok := b.circle.Search(crc); ok {
 			b.circle = append(b.circle[:val], b.circle[val+1:]...)
 		}
+		if _, ok := b.circle.Search(crc); ok {
+			shared = true
+			continue
+		}
+		delete(b.rows, crc)
+	}
+	// a point shared with another element goes to the remaining owners, which
+	// rarely happens, so the circle is simply rebuilt
+	if shared {
+		b.rehash()
 	}
 }
 
+// remove deletes an element together with its health, lease and sticky entries
+// and notifies watchers. The caller must hold the group lock.
+func (b *Group) remove(key string) {
+	b.delete(key)
+	delete(b.health, key)
+	delete(b.leases, key)
+	delete(b.matches, key)
+	if b.sticky != nil {
+		b.sticky.drop(key)
+	}
+	if b.hot != nil {
+		b.hot.forget(key)
+	}
+	b.emit(ElementRemoved, key, nil)
+}
+
 // Delete removes an element from the group
-func (b *Group) Delete(key string) {
+func (b *Group) Delete(key string) error {
 	b.Lock()
 	defer b.Unlock()
-	b.delete(key)
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	if _, ok := b.Elements[key]; ok {
+		b.remove(key)
+	}
+	return nil
 }
 
-// Match returns the key-value pair closest to the given key in a group
+// Remove deletes elements from the group and returns how many of them existed
+func (b *Group) Remove(keys ...string) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return 0, ErrGroupRemoved
+	}
+	removed := 0
+	for _, key := range keys {
+		if _, ok := b.Elements[key]; ok {
+			b.remove(key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Match returns the key-value pair closest to the given key in a group.
+// Elements that are not healthy are skipped by walking the circle
+// to the next point owned by a healthy element. If the sticky table is enabled,
+// keys pinned to a draining element keep matching that element.
 func (b *Group) Match(key string) (string, []byte, error) {
 	crc := b.hash(key)
 	b.RLock()
 	defer b.RUnlock()
+	if b.removed {
+		return "", nil, ErrGroupRemoved
+	}
 
+	if element := b.stickyOwner(key); element != nil {
+		b.countMatch(key, element)
+		return element.Key, element.Payload, nil
+	}
 	if point, ok := b.circle.Match(crc); ok {
-		index := uint32(b.circle[point])
-		return b.rows[index].Key, b.rows[index].Payload, nil
+		element := b.healthyOwner(point)
+		if element == nil {
+			return "", nil, ErrNoHealthyElement
+		}
+		if b.sticky != nil {
+			b.sticky.assign(key, element.Key)
+		}
+		b.countMatch(key, element)
+		return element.Key, element.Payload, nil
 	}
 	return "", nil, ErrNoResultMatched
 }
 
+// MatchN returns up to n distinct healthy elements for the key in the order they
+// follow the key on the circle, e.g. to place replicas. Sticky assignments are
+// not consulted and the match counters are not updated.
+func (b *Group) MatchN(key string, n int) ([]*Element, error) {
+	crc := b.hash(key)
+	b.RLock()
+	defer b.RUnlock()
+	if b.removed {
+		return nil, ErrGroupRemoved
+	}
+
+	point, ok := b.circle.Match(crc)
+	if !ok {
+		return nil, ErrNoResultMatched
+	}
+	healthy := len(b.Elements) - len(b.health)
+	if healthy == 0 {
+		return nil, ErrNoHealthyElement
+	}
+	if n > healthy {
+		n = healthy
+	}
+	if n < 0 {
+		n = 0
+	}
+	elements := make([]*Element, 0, n)
+	seen := make(map[string]bool, n)
+	length := len(b.circle)
+	for i := 0; i < length && len(elements) < n; i++ {
+		element := b.rows[b.circle[(point+i)%length]]
+		if element == nil || seen[element.Key] {
+			continue
+		}
+		seen[element.Key] = true
+		if _, unhealthy := b.health[element.Key]; !unhealthy {
+			elements = append(elements, element)
+		}
+	}
+	return elements, nil
+}
+
 // GetElements get all elements from the group
 func (b *Group) GetElements() []*Element {
 	b.RLock()
@@ -153,3 +401,35 @@ func (b *Group) GetElements() []*Element {
 
 	return els
 }
+
+// MarshalJSON encodes the group under its read lock, so it can be serialized
+// while other goroutines modify it
+func (b *Group) MarshalJSON() ([]byte, error) {
+	b.RLock()
+	defer b.RUnlock()
+	return json.Marshal(&struct {
+		Name             string              `json:"name"`
+		NumberOfReplicas int                 `json:"numberOfReplicas"`
+		Elements         map[string]*Element `json:"elements"`
+	}{b.Name, b.NumberOfReplicas, b.Elements})
+}
+
+// Clone returns an independent copy of the group that is not attached to any CHash,
+// e.g. to try out membership changes without touching the live group
+func (b *Group) Clone() *Group {
+	b.RLock()
+	defer b.RUnlock()
+
+	clone := NewGroup(b.Name, b.NumberOfReplicas)
+	for key, element := range b.Elements {
+		clone.Elements[key] = &Element{Key: element.Key, Payload: element.Payload}
+	}
+	clone.circle = append(clone.circle, b.circle...)
+	for crc, element := range b.rows {
+		clone.rows[crc] = clone.Elements[element.Key]
+	}
+	for key, health := range b.health {
+		clone.setHealth(key, health)
+	}
+	return clone
+}
@@ -5,6 +5,10 @@
 package chash
 
 import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -49,6 +53,30 @@ func TestGroupUpsert(t *testing.T) {
 	assert.Equal(t, payload, group.Elements[key].Payload)
 }
 
+func TestGroupAdd(t *testing.T) {
+	group := NewGroup("test", 100)
+
+	var wg sync.WaitGroup
+	var added int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := group.Add("192.168.1.100:1883", nil); err == nil && ok {
+				atomic.AddInt32(&added, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), added)
+
+	ok, err := group.Add("192.168.1.100:1883", []byte("werbenhu100"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []byte("werbenhu100"), group.Elements["192.168.1.100:1883"].Payload)
+	assert.Equal(t, 100, len(group.circle))
+}
+
 func TestGroupInsert(t *testing.T) {
 	group := NewGroup("test", 10000)
 
@@ -84,6 +112,18 @@ func TestGroupDelete(t *testing.T) {
 	assert.Equal(t, 0, len(group.Elements))
 }
 
+func TestGroupRemove(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", nil)
+	group.Insert("192.168.1.101:1883", nil)
+
+	removed, err := group.Remove("192.168.1.100:1883", "192.168.1.102:1883", "192.168.1.100:1883")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, 1, len(group.Elements))
+	assert.Equal(t, 100, len(group.circle))
+}
+
 func TestGroupMatch(t *testing.T) {
 	group := NewGroup("test", 10000)
 	_, _, err := group.Match("werbenhuxxxxx")
@@ -188,3 +228,71 @@ func BenchmarkGroupMatch(b *testing.B) {
 		group.Match(key)
 	}
 }
+
+func TestGroupRemoved(t *testing.T) {
+	hash := New()
+	group, _ := hash.CreateGroup("test", 100)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+
+	hash.RemoveGroup("test")
+	_, _, err := group.Match("werbenhuxxxxx")
+	assert.Equal(t, ErrGroupRemoved, err)
+	assert.Equal(t, ErrGroupRemoved, group.Insert("192.168.1.101:1883", nil))
+	assert.Equal(t, 0, len(group.GetElements()))
+
+	group, _ = hash.CreateGroup("test", 100)
+	hash.RemoveAllGroup()
+	assert.Equal(t, ErrGroupRemoved, group.Delete("192.168.1.100:1883"))
+}
+
+func TestGroupMarshalJSON(t *testing.T) {
+	group := NewGroup("test", 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			group.Upsert("192.168.1.100:1883", []byte(strconv.Itoa(i)))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := json.Marshal(group)
+		assert.Nil(t, err)
+	}
+	<-done
+
+	data, _ := json.Marshal(group)
+	assert.JSONEq(t, `{"name":"test","numberOfReplicas":10,"elements":{"192.168.1.100:1883":{"key":"192.168.1.100:1883","payload":"OTk="}}}`, string(data))
+}
+
+func TestGroupMatchN(t *testing.T) {
+	group := NewGroup("test", 100)
+	_, err := group.MatchN("user-id-1", 2)
+	assert.Equal(t, ErrNoResultMatched, err)
+
+	group.Insert("192.168.1.100:1883", nil)
+	group.Insert("192.168.1.101:1883", nil)
+	group.Insert("192.168.1.102:1883", nil)
+
+	first, _, _ := group.Match("user-id-1")
+	elements, err := group.MatchN("user-id-1", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(elements))
+	assert.Equal(t, first, elements[0].Key)
+	assert.NotEqual(t, elements[0].Key, elements[1].Key)
+
+	elements, _ = group.MatchN("user-id-1", 10)
+	assert.Equal(t, 3, len(elements))
+
+	group.SetHealth(first, Unhealthy)
+	elements, _ = group.MatchN("user-id-1", 3)
+	assert.Equal(t, 2, len(elements))
+	for _, element := range elements {
+		assert.NotEqual(t, first, element.Key)
+	}
+
+	group.SetHealth("192.168.1.100:1883", Unhealthy)
+	group.SetHealth("192.168.1.101:1883", Unhealthy)
+	group.SetHealth("192.168.1.102:1883", Unhealthy)
+	_, err = group.MatchN("user-id-1", 1)
+	assert.Equal(t, ErrNoHealthyElement, err)
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+// Health is the health state of an element. Match only returns healthy elements,
+// the others keep their points on the circle so they get their keys back
+// as soon as they are healthy again.
+type Health int
+
+const (
+	// Healthy elements are returned by Match. This is the state of every new element.
+	Healthy Health = iota
+
+	// Unhealthy elements are skipped by Match.
+	Unhealthy
+
+	// Draining elements are being retired. Match skips them except for keys
+	// pinned to them in the sticky table, see Group.Drain.
+	Draining
+)
+
+// String returns the name of the health state
+func (h Health) String() string {
+	switch h {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	case Draining:
+		return "draining"
+	}
+	return "unknown"
+}
+
+// setHealth records the health of an element, the caller must hold the group lock.
+// The sticky keys of an element are held while it is draining.
+func (b *Group) setHealth(key string, health Health) {
+	if draining := health == Draining; b.sticky != nil && draining != (b.health[key] == Draining) {
+		if draining {
+			b.sticky.hold(key)
+		} else {
+			b.sticky.unhold(key)
+		}
+	}
+	if health == Healthy {
+		delete(b.health, key)
+		return
+	}
+	if b.health == nil {
+		b.health = make(map[string]Health)
+	}
+	b.health[key] = health
+}
+
+// healthyOwner walks the circle from the given point and returns the first
+// element that is healthy, or nil if there is none. The caller must hold the group lock.
+func (b *Group) healthyOwner(point int) *Element {
+	length := len(b.circle)
+	for i := 0; i < length; i++ {
+		element := b.rows[b.circle[(point+i)%length]]
+		if element == nil {
+			continue
+		}
+		if _, unhealthy := b.health[element.Key]; !unhealthy {
+			return element
+		}
+		if len(b.health) == len(b.Elements) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// SetHealth changes the health state of an element without moving it on the circle
+func (b *Group) SetHealth(key string, health Health) error {
+	if health < Healthy || health > Draining {
+		return ErrInvalidHealth
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	if _, ok := b.Elements[key]; !ok {
+		return ErrKeyNotFound
+	}
+	b.setHealth(key, health)
+	return nil
+}
+
+// Health returns the health state of an element
+func (b *Group) Health(key string) (Health, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.removed {
+		return Healthy, ErrGroupRemoved
+	}
+	if _, ok := b.Elements[key]; !ok {
+		return Healthy, ErrKeyNotFound
+	}
+	return b.health[key], nil
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthString(t *testing.T) {
+	assert.Equal(t, "healthy", Healthy.String())
+	assert.Equal(t, "unhealthy", Unhealthy.String())
+	assert.Equal(t, "draining", Draining.String())
+	assert.Equal(t, "unknown", Health(10).String())
+}
+
+func TestGroupSetHealth(t *testing.T) {
+	hash := New()
+	group, _ := hash.CreateGroup("test", 100)
+	group.Insert("192.168.1.100:1883", nil)
+
+	health, err := group.Health("192.168.1.100:1883")
+	assert.Nil(t, err)
+	assert.Equal(t, Healthy, health)
+
+	assert.Nil(t, group.SetHealth("192.168.1.100:1883", Draining))
+	health, _ = group.Health("192.168.1.100:1883")
+	assert.Equal(t, Draining, health)
+
+	assert.Equal(t, ErrInvalidHealth, group.SetHealth("192.168.1.100:1883", Health(5)))
+	assert.Equal(t, ErrKeyNotFound, group.SetHealth("192.168.1.101:1883", Unhealthy))
+	_, err = group.Health("192.168.1.101:1883")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	group.Upsert("192.168.1.100:1883", []byte("werbenhu100"))
+	health, _ = group.Health("192.168.1.100:1883")
+	assert.Equal(t, Draining, health)
+
+	group.Delete("192.168.1.100:1883")
+	group.Insert("192.168.1.100:1883", nil)
+	health, _ = group.Health("192.168.1.100:1883")
+	assert.Equal(t, Healthy, health)
+
+	hash.RemoveGroup("test")
+	assert.Equal(t, ErrGroupRemoved, group.SetHealth("192.168.1.100:1883", Unhealthy))
+	_, err = group.Health("192.168.1.100:1883")
+	assert.Equal(t, ErrGroupRemoved, err)
+}
+
+func TestGroupMatchFailover(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	group.Insert("192.168.1.101:1883", []byte("werbenhu101"))
+	group.Insert("192.168.1.102:1883", []byte("werbenhu102"))
+
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-id-%d", i)
+		owners[key], _, _ = group.Match(key)
+	}
+	circle := append(Circle{}, group.circle...)
+
+	assert.Nil(t, group.SetHealth("192.168.1.100:1883", Unhealthy))
+	for key, owner := range owners {
+		matched, payload, err := group.Match(key)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "192.168.1.100:1883", matched)
+		assert.Equal(t, []byte("werbenhu"+matched[10:13]), payload)
+		if owner != "192.168.1.100:1883" {
+			assert.Equal(t, owner, matched)
+		}
+	}
+	assert.Equal(t, circle, group.circle)
+
+	group.SetHealth("192.168.1.101:1883", Draining)
+	group.SetHealth("192.168.1.102:1883", Unhealthy)
+	_, _, err := group.Match("user-id-1")
+	assert.Equal(t, ErrNoHealthyElement, err)
+
+	group.SetHealth("192.168.1.100:1883", Healthy)
+	group.SetHealth("192.168.1.101:1883", Healthy)
+	group.SetHealth("192.168.1.102:1883", Healthy)
+	for key, owner := range owners {
+		matched, _, _ := group.Match(key)
+		assert.Equal(t, owner, matched)
+	}
+}
+
+func TestRestoreKeepsHealth(t *testing.T) {
+	hash := New()
+	group, _ := hash.CreateGroup("test", 10)
+	group.Insert("a", nil)
+	group.Insert("b", nil)
+	group.SetHealth("a", Unhealthy)
+	group.SetHealth("b", Unhealthy)
+
+	err := hash.Restore([]byte(`{"test":{"name":"test","numberOfReplicas":10,"elements":{"a":{"key":"a"},"c":{"key":"c"}}}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]Health{"a": Unhealthy}, group.health)
+
+	clone := group.Clone()
+	assert.Equal(t, map[string]Health{"a": Unhealthy}, clone.health)
+}
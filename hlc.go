@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"sync"
+	"time"
+)
+
+// Timestamp is a hybrid logical clock timestamp: the wall time in nanoseconds,
+// a logical counter ordering events within the same wall time, and the node
+// that took it, so timestamps of different nodes never compare equal.
+type Timestamp struct {
+	Wall    int64  `json:"wall"`
+	Logical uint32 `json:"logical"`
+	Node    string `json:"node"`
+}
+
+// Less reports whether t orders before o
+func (t Timestamp) Less(o Timestamp) bool {
+	if t.Wall != o.Wall {
+		return t.Wall < o.Wall
+	}
+	if t.Logical != o.Logical {
+		return t.Logical < o.Logical
+	}
+	return t.Node < o.Node
+}
+
+// IsZero reports whether t is the zero timestamp
+func (t Timestamp) IsZero() bool {
+	return t == Timestamp{}
+}
+
+// HLC is a hybrid logical clock. Its timestamps follow the wall clock where
+// possible, but never go backwards and always order after every timestamp
+// the clock has observed from other nodes, even if their wall clocks run ahead.
+type HLC struct {
+	mu    sync.Mutex
+	node  string
+	last  Timestamp
+	clock Clock
+}
+
+// NewHLC creates a hybrid logical clock for the given node, which must be unique
+// among the nodes. It reads the wall time from clock, nil meaning the system clock.
+func NewHLC(node string, clock Clock) *HLC {
+	return &HLC{node: node, clock: clock}
+}
+
+// Now returns a timestamp that orders after every timestamp returned or observed before
+func (c *HLC) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.clock != nil {
+		now = c.clock.Now()
+	}
+	wall := now.UnixNano()
+	if wall > c.last.Wall {
+		c.last = Timestamp{Wall: wall, Node: c.node}
+	} else {
+		c.last = Timestamp{Wall: c.last.Wall, Logical: c.last.Logical + 1, Node: c.node}
+	}
+	return c.last
+}
+
+// Observe advances the clock past a timestamp received from another node
+func (c *HLC) Observe(remote Timestamp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remote.Wall > c.last.Wall || (remote.Wall == c.last.Wall && remote.Logical > c.last.Logical) {
+		c.last = Timestamp{Wall: remote.Wall, Logical: remote.Logical, Node: c.node}
+	}
+}
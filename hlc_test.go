@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampLess(t *testing.T) {
+	assert.True(t, Timestamp{Wall: 1}.Less(Timestamp{Wall: 2}))
+	assert.True(t, Timestamp{Wall: 2, Logical: 1}.Less(Timestamp{Wall: 2, Logical: 2}))
+	assert.True(t, Timestamp{Wall: 2, Logical: 1, Node: "a"}.Less(Timestamp{Wall: 2, Logical: 1, Node: "b"}))
+	assert.False(t, Timestamp{Wall: 2, Node: "a"}.Less(Timestamp{Wall: 2, Node: "a"}))
+	assert.True(t, Timestamp{}.IsZero())
+	assert.False(t, Timestamp{Node: "a"}.IsZero())
+}
+
+func TestHLC(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	hlc := NewHLC("a", clock)
+
+	first := hlc.Now()
+	assert.Equal(t, Timestamp{Wall: time.Unix(1000, 0).UnixNano(), Node: "a"}, first)
+	second := hlc.Now()
+	assert.Equal(t, Timestamp{Wall: first.Wall, Logical: 1, Node: "a"}, second)
+
+	// the wall clock going backwards does not make the clock go backwards
+	clock.Advance(-time.Second)
+	third := hlc.Now()
+	assert.True(t, second.Less(third))
+
+	// a remote clock running ahead is followed
+	remote := Timestamp{Wall: first.Wall + int64(time.Hour), Logical: 5, Node: "b"}
+	hlc.Observe(remote)
+	next := hlc.Now()
+	assert.True(t, remote.Less(next))
+	assert.Equal(t, Timestamp{Wall: remote.Wall, Logical: 6, Node: "a"}, next)
+
+	hlc.Observe(Timestamp{Wall: first.Wall, Node: "b"})
+	assert.True(t, next.Less(hlc.Now()))
+
+	clock.Advance(2 * time.Hour)
+	assert.Equal(t, Timestamp{Wall: clock.Now().UnixNano(), Node: "a"}, hlc.Now())
+
+	system := NewHLC("a", nil)
+	assert.True(t, system.Now().Wall > 0)
+}
@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHotKeys is the number of lookup keys tracked by EnableInstrumentation
+// when no capacity is given.
+const DefaultHotKeys = 16
+
+// HotKey is a frequently matched lookup key.
+// Count may overestimate the real number of lookups by at most Error.
+type HotKey struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+	Error uint64 `json:"error"`
+}
+
+// MatchSnapshot reports the lookups of a group since instrumentation was
+// enabled or last reset
+type MatchSnapshot struct {
+	Since time.Time `json:"since"`
+
+	// Total is the number of successful matches.
+	Total uint64 `json:"total"`
+
+	// Matches is the number of matches of each element.
+	Matches map[string]uint64 `json:"matches"`
+
+	// HotKeys lists the most frequent lookup keys, the most frequent first.
+	HotKeys []HotKey `json:"hotKeys"`
+}
+
+// hotEntry is a tracked key and its position in the heap
+type hotEntry struct {
+	HotKey
+	index int
+}
+
+// hotHeap is a min-heap of tracked keys by count
+type hotHeap []*hotEntry
+
+func (h hotHeap) Len() int           { return len(h) }
+func (h hotHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h hotHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hotHeap) Push(x interface{}) {
+	e := x.(*hotEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *hotHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// hotKeys is a space-saving top-K summary of lookup keys.
+// When it is full a new key replaces the least frequent one and inherits its count,
+// so every key seen more than total/capacity times is guaranteed to be kept.
+type hotKeys struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*hotEntry
+	heap     hotHeap
+	since    time.Time
+
+	// base holds the element counters at the last reset
+	base map[string]uint64
+}
+
+// newHotKeys creates an empty summary
+func newHotKeys(capacity int, since time.Time) *hotKeys {
+	h := &hotKeys{capacity: capacity, since: since, base: make(map[string]uint64)}
+	h.clear()
+	return h
+}
+
+// clear forgets all tracked keys, the caller must hold the lock
+func (h *hotKeys) clear() {
+	h.entries = make(map[string]*hotEntry, h.capacity)
+	h.heap = make(hotHeap, 0, h.capacity)
+}
+
+// record counts a lookup of key
+func (h *hotKeys) record(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e, ok := h.entries[key]; ok {
+		e.Count++
+		heap.Fix(&h.heap, e.index)
+		return
+	}
+	if len(h.heap) < h.capacity {
+		e := &hotEntry{HotKey: HotKey{Key: key, Count: 1}}
+		h.entries[key] = e
+		heap.Push(&h.heap, e)
+		return
+	}
+	min := h.heap[0]
+	delete(h.entries, min.Key)
+	min.Key, min.Error = key, min.Count
+	min.Count++
+	h.entries[key] = min
+	heap.Fix(&h.heap, 0)
+}
+
+// forget drops the counter base of a removed element
+func (h *hotKeys) forget(element string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.base, element)
+}
+
+// top returns the tracked keys, the most frequent first, the caller must hold the lock
+func (h *hotKeys) top() []HotKey {
+	keys := make([]HotKey, 0, len(h.heap))
+	for _, e := range h.heap {
+		keys = append(keys, e.HotKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// EnableInstrumentation starts tracking the most frequent lookup keys of Match,
+// up to capacity keys, 0 meaning DefaultHotKeys. Enabling it again starts over.
+// The per-element counters are lock-free, the key summary takes a short lock per match.
+func (b *Group) EnableInstrumentation(capacity int) error {
+	if capacity < 0 {
+		return ErrInvalidCapacity
+	}
+	if capacity == 0 {
+		capacity = DefaultHotKeys
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	b.hot = newHotKeys(capacity, b.now())
+	b.hot.base = b.readMatches()
+	return nil
+}
+
+// DisableInstrumentation stops tracking lookup keys
+func (b *Group) DisableInstrumentation() {
+	b.Lock()
+	defer b.Unlock()
+	b.hot = nil
+}
+
+// readMatches reads the element counters, the caller must hold the group lock
+func (b *Group) readMatches() map[string]uint64 {
+	counts := make(map[string]uint64, len(b.matches))
+	for key, counter := range b.matches {
+		counts[key] = atomic.LoadUint64(counter)
+	}
+	return counts
+}
+
+// MatchSnapshot returns the lookups since instrumentation was enabled or last reset.
+// With reset the counters start over from the returned snapshot.
+func (b *Group) MatchSnapshot(reset bool) (*MatchSnapshot, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.removed {
+		return nil, ErrGroupRemoved
+	}
+	if b.hot == nil {
+		return nil, ErrNotInstrumented
+	}
+
+	counts := b.readMatches()
+	b.hot.mu.Lock()
+	defer b.hot.mu.Unlock()
+	snapshot := &MatchSnapshot{
+		Since:   b.hot.since,
+		Matches: make(map[string]uint64, len(counts)),
+		HotKeys: b.hot.top(),
+	}
+	for key, n := range counts {
+		n -= b.hot.base[key]
+		snapshot.Matches[key] = n
+		snapshot.Total += n
+	}
+	if reset {
+		b.hot.base = counts
+		b.hot.since = b.now()
+		b.hot.clear()
+	}
+	return snapshot, nil
+}
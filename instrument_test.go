@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotKeys(t *testing.T) {
+	h := newHotKeys(2, time.Time{})
+	h.record("a")
+	h.record("a")
+	h.record("a")
+	h.record("b")
+	h.record("c")
+	h.record("c")
+
+	assert.Equal(t, []HotKey{
+		{Key: "a", Count: 3},
+		{Key: "c", Count: 3, Error: 1},
+	}, h.top())
+}
+
+func TestGroupMatchSnapshot(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	group := NewGroup("test", 100)
+	group.SetClock(clock)
+	group.Insert("192.168.1.100:1883", nil)
+	group.Insert("192.168.1.101:1883", nil)
+
+	_, err := group.MatchSnapshot(false)
+	assert.Equal(t, ErrNotInstrumented, err)
+	assert.Equal(t, ErrInvalidCapacity, group.EnableInstrumentation(-1))
+
+	group.Match("before")
+	assert.Nil(t, group.EnableInstrumentation(3))
+	for i := 0; i < 10; i++ {
+		group.Match("hot")
+	}
+	for i := 0; i < 5; i++ {
+		group.Match("key" + strconv.Itoa(i))
+	}
+
+	clock.Advance(time.Minute)
+	snapshot, err := group.MatchSnapshot(true)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1000, 0), snapshot.Since)
+	assert.Equal(t, uint64(15), snapshot.Total)
+	assert.Equal(t, 2, len(snapshot.Matches))
+	assert.Equal(t, 3, len(snapshot.HotKeys))
+	assert.Equal(t, HotKey{Key: "hot", Count: 10}, snapshot.HotKeys[0])
+
+	hot, _, _ := group.Match("hot")
+	snapshot, _ = group.MatchSnapshot(false)
+	assert.Equal(t, time.Unix(1060, 0), snapshot.Since)
+	assert.Equal(t, uint64(1), snapshot.Total)
+	assert.Equal(t, uint64(1), snapshot.Matches[hot])
+	assert.Equal(t, []HotKey{{Key: "hot", Count: 1}}, snapshot.HotKeys)
+
+	group.MatchSnapshot(true)
+	group.Delete(hot)
+	group.Insert(hot, nil)
+	group.Match("hot")
+	group.Match("hot")
+	snapshot, _ = group.MatchSnapshot(false)
+	assert.Equal(t, uint64(2), snapshot.Matches[hot])
+
+	group.DisableInstrumentation()
+	_, err = group.MatchSnapshot(false)
+	assert.Equal(t, ErrNotInstrumented, err)
+}
+
+func BenchmarkGroupMatchInstrumented(b *testing.B) {
+	group := NewGroup("test", 10000)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	group.Insert("192.168.1.101:1883", []byte("werbenhu101"))
+	group.EnableInstrumentation(DefaultHotKeys)
+
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "user-" + strconv.Itoa(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		group.Match(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkGroupMatchInstrumentedParallel(b *testing.B) {
+	group := NewGroup("test", 10000)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	group.Insert("192.168.1.101:1883", []byte("werbenhu101"))
+	group.EnableInstrumentation(DefaultHotKeys)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			group.Match("xxxxx")
+		}
+	})
+}
@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultReapInterval is the interval of a Reaper created with a non-positive interval
+const DefaultReapInterval = time.Second
+
+// Clock tells the current time, it can be replaced in tests
+type Clock interface {
+	Now() time.Time
+}
+
+// lease is the time to live of an element
+type lease struct {
+	ttl     time.Duration
+	expires time.Time
+}
+
+// SetClock replaces the clock used for leases, nil restores the system clock
+func (b *Group) SetClock(clock Clock) {
+	b.Lock()
+	defer b.Unlock()
+	b.clock = clock
+}
+
+// now returns the current time of the group's clock, the caller must hold the group lock
+func (b *Group) now() time.Time {
+	if b.clock == nil {
+		return time.Now()
+	}
+	return b.clock.Now()
+}
+
+// InsertWithTTL adds a new element that is removed by a Reaper unless it is
+// renewed with Renew within ttl. Elements added by Insert or Upsert never expire,
+// Upsert on an element with a lease replaces its payload and keeps the lease.
+func (b *Group) InsertWithTTL(key string, payload []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	b.Lock()
+	defer b.Unlock()
+	if err := b.insert(key, payload); err != nil {
+		return err
+	}
+	if b.leases == nil {
+		b.leases = make(map[string]lease)
+	}
+	b.leases[key] = lease{ttl: ttl, expires: b.now().Add(ttl)}
+	return nil
+}
+
+// Renew extends the lease of an element by its ttl from now
+func (b *Group) Renew(key string) error {
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	if _, ok := b.Elements[key]; !ok {
+		return ErrKeyNotFound
+	}
+	l, ok := b.leases[key]
+	if !ok {
+		return ErrNoLease
+	}
+	l.expires = b.now().Add(l.ttl)
+	b.leases[key] = l
+	return nil
+}
+
+// expire removes the elements whose lease has expired and returns them
+func (b *Group) expire() []*Element {
+	b.Lock()
+	defer b.Unlock()
+	expired := make([]*Element, 0)
+	now := b.now()
+	for key, l := range b.leases {
+		if now.Before(l.expires) {
+			continue
+		}
+		if element, ok := b.Elements[key]; ok {
+			expired = append(expired, element)
+			b.remove(key)
+		}
+	}
+	return expired
+}
+
+// Reaper periodically removes the elements of a group whose lease has expired
+type Reaper struct {
+	group    *Group
+	interval time.Duration
+	onExpire func(*Element)
+
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewReaper creates a reaper that checks the group's leases every interval,
+// DefaultReapInterval if interval is not positive. onExpire, if not nil, is called
+// for every removed element without holding the group lock, so it may call back into the group.
+func NewReaper(group *Group, interval time.Duration, onExpire func(*Element)) *Reaper {
+	if interval <= 0 {
+		interval = DefaultReapInterval
+	}
+	return &Reaper{
+		group:    group,
+		interval: interval,
+		onExpire: onExpire,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Reap removes the expired elements right away and returns how many were removed
+func (r *Reaper) Reap() int {
+	expired := r.group.expire()
+	if r.onExpire != nil {
+		for _, element := range expired {
+			r.onExpire(element)
+		}
+	}
+	return len(expired)
+}
+
+// Start runs Reap every interval in a background goroutine until Stop is called
+func (r *Reaper) Start() {
+	r.startOnce.Do(func() {
+		go r.loop()
+	})
+}
+
+// loop is the background goroutine of the reaper
+func (r *Reaper) loop() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.Reap()
+		}
+	}
+}
+
+// Stop stops the background goroutine and waits for it to exit.
+// A stopped reaper cannot be started again.
+func (r *Reaper) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	r.startOnce.Do(func() {
+		close(r.done)
+	})
+	<-r.done
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock that only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestGroupInsertWithTTL(t *testing.T) {
+	group := NewGroup("test", 10)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	group.SetClock(clock)
+
+	assert.Equal(t, ErrInvalidTTL, group.InsertWithTTL("192.168.1.100:1883", nil, 0))
+	assert.Nil(t, group.InsertWithTTL("192.168.1.100:1883", nil, time.Second))
+	assert.Equal(t, ErrKeyExisted, group.InsertWithTTL("192.168.1.100:1883", nil, time.Second))
+	assert.Equal(t, lease{ttl: time.Second, expires: time.Unix(1001, 0)}, group.leases["192.168.1.100:1883"])
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Nil(t, group.Renew("192.168.1.100:1883"))
+	assert.Equal(t, time.Unix(1001, 500000000), group.leases["192.168.1.100:1883"].expires)
+
+	assert.Nil(t, group.Upsert("192.168.1.100:1883", []byte("werbenhu100")))
+	assert.Equal(t, time.Unix(1001, 500000000), group.leases["192.168.1.100:1883"].expires)
+
+	group.Insert("192.168.1.101:1883", nil)
+	assert.Equal(t, ErrNoLease, group.Renew("192.168.1.101:1883"))
+	assert.Equal(t, ErrKeyNotFound, group.Renew("192.168.1.102:1883"))
+
+	group.Delete("192.168.1.100:1883")
+	assert.Equal(t, 0, len(group.leases))
+
+	group.SetClock(nil)
+	assert.Nil(t, group.InsertWithTTL("192.168.1.100:1883", nil, time.Hour))
+	assert.True(t, group.leases["192.168.1.100:1883"].expires.After(time.Now()))
+}
+
+func TestReaperReap(t *testing.T) {
+	group := NewGroup("test", 10)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	group.SetClock(clock)
+	group.InsertWithTTL("192.168.1.100:1883", []byte("werbenhu100"), time.Second)
+	group.InsertWithTTL("192.168.1.101:1883", []byte("werbenhu101"), 3*time.Second)
+	group.Insert("192.168.1.102:1883", []byte("werbenhu102"))
+	events := group.Watch(context.Background())
+
+	expired := make([]*Element, 0)
+	reaper := NewReaper(group, time.Hour, func(element *Element) {
+		// the group lock must not be held while calling back
+		group.Insert("callback", nil)
+		group.Delete("callback")
+		expired = append(expired, element)
+	})
+
+	assert.Equal(t, 0, reaper.Reap())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, 1, reaper.Reap())
+	assert.Equal(t, []*Element{{Key: "192.168.1.100:1883", Payload: []byte("werbenhu100")}}, expired)
+	assert.Equal(t, 2, len(group.Elements))
+	assert.Equal(t, Event{Type: ElementRemoved, Group: "test", Key: "192.168.1.100:1883", Version: 4}, drain(events)[0])
+
+	group.Renew("192.168.1.101:1883")
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, 0, reaper.Reap())
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, 1, reaper.Reap())
+	assert.Equal(t, 1, len(group.Elements))
+	assert.Equal(t, 0, len(group.leases))
+}
+
+func TestReaperStartStop(t *testing.T) {
+	group := NewGroup("test", 10)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	group.SetClock(clock)
+	group.InsertWithTTL("192.168.1.100:1883", nil, time.Second)
+	clock.Advance(time.Second)
+
+	expired := make(chan *Element, 1)
+	reaper := NewReaper(group, time.Millisecond, func(element *Element) {
+		expired <- element
+	})
+	reaper.Start()
+	reaper.Start()
+
+	select {
+	case element := <-expired:
+		assert.Equal(t, "192.168.1.100:1883", element.Key)
+	case <-time.After(5 * time.Second):
+		t.Fatal("element not reaped")
+	}
+	reaper.Stop()
+	reaper.Stop()
+
+	idle := NewReaper(group, time.Millisecond, nil)
+	idle.Stop()
+	idle.Start()
+
+	zero := NewReaper(group, 0, nil)
+	assert.Equal(t, DefaultReapInterval, zero.interval)
+	zero.Start()
+	zero.Stop()
+}
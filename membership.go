@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// Tag is a single add of an element to a Membership, identified by its timestamp
+type Tag struct {
+	Key     string    `json:"key"`
+	Payload []byte    `json:"payload,omitempty"`
+	Time    Timestamp `json:"time"`
+}
+
+// ReplicasRegister holds the number of replicas and when it was set
+type ReplicasRegister struct {
+	Value int       `json:"value"`
+	Time  Timestamp `json:"time"`
+}
+
+// MembershipState is the replicated state of a Membership, exchanged between nodes
+type MembershipState struct {
+	Replicas ReplicasRegister `json:"replicas"`
+
+	// Tags are the adds that were not removed, sorted by key and timestamp.
+	Tags []Tag `json:"tags"`
+
+	// Removed are the timestamps of the tags that were removed, sorted.
+	Removed []Timestamp `json:"removed"`
+}
+
+// Membership is an observed-remove set of the elements of a group that several
+// nodes change independently, e.g. while partitioned, and then Merge.
+//
+// Every Add is tagged with a hybrid logical clock timestamp and Remove only
+// removes the tags it has seen, so an add concurrent with a remove wins.
+// When an element has several tags, the payload of the latest one is used.
+// The number of replicas is a last-writer-wins register. Merging is commutative,
+// associative and idempotent, so nodes that have merged the same changes, in any
+// order, apply the same elements, payloads and replicas to their groups, which
+// then have identical rings and fingerprints.
+//
+// Removed timestamps are kept forever, so the state grows with every remove.
+type Membership struct {
+	mu       sync.Mutex
+	clock    *HLC
+	group    *Group
+	replicas ReplicasRegister
+	tags     map[Timestamp]Tag
+	removed  map[Timestamp]struct{}
+}
+
+// NewMembership creates a membership for the given node backed by the group.
+// The elements already in the group are added by the node, and the number of
+// replicas of the group is taken with a zero timestamp, so it yields to any SetReplicas.
+// Seed the elements on one node only and start the others from an empty group,
+// otherwise a remove on one node does not remove the seeds of the others.
+func NewMembership(node string, group *Group) (*Membership, error) {
+	if node == "" {
+		return nil, ErrInvalidNode
+	}
+	m := &Membership{
+		clock:   NewHLC(node, nil),
+		group:   group,
+		tags:    make(map[Timestamp]Tag),
+		removed: make(map[Timestamp]struct{}),
+	}
+
+	group.RLock()
+	removed := group.removed
+	m.replicas.Value = group.NumberOfReplicas
+	keys := make([]string, 0, len(group.Elements))
+	for key := range group.Elements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tag := Tag{Key: key, Payload: group.Elements[key].Payload, Time: m.clock.Now()}
+		m.tags[tag.Time] = tag
+	}
+	group.RUnlock()
+	if removed {
+		return nil, ErrGroupRemoved
+	}
+	return m, nil
+}
+
+// Group returns the group backed by the membership
+func (m *Membership) Group() *Group {
+	return m.group
+}
+
+// Add adds an element or replaces its payload. It replaces the tags of the
+// element seen so far, adds concurrent with it on other nodes are kept.
+// It returns ErrTooManyPoints if the group would have more than DefaultMaxPoints virtual nodes.
+func (m *Membership) Add(key string, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := m.elements()
+	count := len(members)
+	if _, ok := members[key]; !ok {
+		count++
+	}
+	if exceedsPoints(count, m.replicas.Value, DefaultMaxPoints) {
+		return ErrTooManyPoints
+	}
+	m.drop(key)
+	tag := Tag{Key: key, Payload: payload, Time: m.clock.Now()}
+	m.tags[tag.Time] = tag
+	return m.apply()
+}
+
+// Remove removes an element by removing all of its tags seen so far.
+// It returns ErrKeyNotFound if the element is not a member.
+func (m *Membership) Remove(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.drop(key) {
+		return ErrKeyNotFound
+	}
+	return m.apply()
+}
+
+// SetReplicas sets the number of replicas of the group, at most DefaultMaxReplicas.
+// It returns ErrTooManyPoints if the members would have more than DefaultMaxPoints virtual nodes.
+func (m *Membership) SetReplicas(replicas int) error {
+	if replicas <= 0 || replicas > DefaultMaxReplicas {
+		return ErrInvalidReplicas
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if exceedsPoints(len(m.elements()), replicas, DefaultMaxPoints) {
+		return ErrTooManyPoints
+	}
+	m.replicas = ReplicasRegister{Value: replicas, Time: m.clock.Now()}
+	return m.apply()
+}
+
+// drop removes the tags of an element and reports whether it had any.
+// The caller must hold m.mu.
+func (m *Membership) drop(key string) bool {
+	found := false
+	for time, tag := range m.tags {
+		if tag.Key == key {
+			delete(m.tags, time)
+			m.removed[time] = struct{}{}
+			found = true
+		}
+	}
+	return found
+}
+
+// State returns a copy of the replicated state to send to other nodes
+func (m *Membership) State() MembershipState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := MembershipState{
+		Replicas: m.replicas,
+		Tags:     make([]Tag, 0, len(m.tags)),
+		Removed:  make([]Timestamp, 0, len(m.removed)),
+	}
+	for _, tag := range m.tags {
+		state.Tags = append(state.Tags, tag)
+	}
+	sort.Slice(state.Tags, func(i, j int) bool {
+		if state.Tags[i].Key != state.Tags[j].Key {
+			return state.Tags[i].Key < state.Tags[j].Key
+		}
+		return state.Tags[i].Time.Less(state.Tags[j].Time)
+	})
+	for time := range m.removed {
+		state.Removed = append(state.Removed, time)
+	}
+	sort.Slice(state.Removed, func(i, j int) bool {
+		return state.Removed[i].Less(state.Removed[j])
+	})
+	return state
+}
+
+// validate checks a state received from another node, so a bad peer cannot
+// make every node it is merged into build a huge circle
+func (s MembershipState) validate() error {
+	if s.Replicas.Value <= 0 || s.Replicas.Value > DefaultMaxReplicas {
+		return ErrInvalidMembership
+	}
+	keys := make(map[string]struct{}, len(s.Tags))
+	for _, tag := range s.Tags {
+		if tag.Key == "" || tag.Time.Node == "" {
+			return ErrInvalidMembership
+		}
+		keys[tag.Key] = struct{}{}
+	}
+	if exceedsPoints(len(keys), s.Replicas.Value, DefaultMaxPoints) {
+		return ErrInvalidMembership
+	}
+	return nil
+}
+
+// Merge merges the state of another membership into m
+func (m *Membership) Merge(other *Membership) error {
+	return m.MergeState(other.State())
+}
+
+// MergeState merges a state received from another node into m and applies the
+// result to the group. Tags removed on either side stay removed, all other
+// tags of both sides are kept, and the later replicas register wins.
+// It returns ErrInvalidMembership for a malformed state and ErrTooManyPoints if
+// the merged group would have more than DefaultMaxPoints virtual nodes, in both
+// cases m is left unchanged.
+func (m *Membership) MergeState(state MembershipState) error {
+	if err := state.validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.exceedsPoints(state) {
+		return ErrTooManyPoints
+	}
+
+	for _, time := range state.Removed {
+		m.removed[time] = struct{}{}
+		delete(m.tags, time)
+		m.clock.Observe(time)
+	}
+	for _, tag := range state.Tags {
+		m.clock.Observe(tag.Time)
+		if _, ok := m.removed[tag.Time]; !ok {
+			m.tags[tag.Time] = tag
+		}
+	}
+	// ties only happen between registers that were never set, where the larger value wins
+	if m.replicas.Time.Less(state.Replicas.Time) ||
+		(m.replicas.Time == state.Replicas.Time && m.replicas.Value < state.Replicas.Value) {
+		m.replicas = state.Replicas
+	}
+	m.clock.Observe(state.Replicas.Time)
+	return m.apply()
+}
+
+// exceedsPoints reports whether merging the state would give the group more than
+// DefaultMaxPoints virtual nodes. The caller must hold m.mu.
+func (m *Membership) exceedsPoints(state MembershipState) bool {
+	removed := make(map[Timestamp]struct{}, len(state.Removed))
+	for _, time := range state.Removed {
+		removed[time] = struct{}{}
+	}
+	keys := make(map[string]struct{}, len(m.tags)+len(state.Tags))
+	for time, tag := range m.tags {
+		if _, ok := removed[time]; !ok {
+			keys[tag.Key] = struct{}{}
+		}
+	}
+	for _, tag := range state.Tags {
+		if _, ok := m.removed[tag.Time]; !ok {
+			keys[tag.Key] = struct{}{}
+		}
+	}
+	replicas := m.replicas.Value
+	if m.replicas.Time.Less(state.Replicas.Time) ||
+		(m.replicas.Time == state.Replicas.Time && replicas < state.Replicas.Value) {
+		replicas = state.Replicas.Value
+	}
+	return exceedsPoints(len(keys), replicas, DefaultMaxPoints)
+}
+
+// elements returns the latest tag of every member. The caller must hold m.mu.
+func (m *Membership) elements() map[string]Tag {
+	latest := make(map[string]Tag, len(m.tags))
+	for _, tag := range m.tags {
+		if current, ok := latest[tag.Key]; !ok || current.Time.Less(tag.Time) {
+			latest[tag.Key] = tag
+		}
+	}
+	return latest
+}
+
+// apply brings the group in line with the membership. The caller must hold m.mu.
+func (m *Membership) apply() error {
+	latest := m.elements()
+	b := m.group
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return ErrGroupRemoved
+	}
+
+	if b.NumberOfReplicas != m.replicas.Value {
+		b.NumberOfReplicas = m.replicas.Value
+		b.rehash()
+		b.emit(ReplicasChanged, "", nil)
+	}
+	stale := make([]string, 0)
+	for key := range b.Elements {
+		if _, ok := latest[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	for _, key := range stale {
+		b.remove(key)
+	}
+
+	keys := make([]string, 0, len(latest))
+	for key := range latest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if element, ok := b.Elements[key]; ok && bytes.Equal(element.Payload, latest[key].Payload) {
+			continue
+		}
+		b.upsert(key, latest[key].Payload)
+	}
+	return nil
+}
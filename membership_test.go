@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newMembership creates a membership of an empty group whose wall clock only moves when told to
+func newMembership(t *testing.T, node string, clock Clock) *Membership {
+	m, err := NewMembership(node, NewGroup("test", 10))
+	assert.Nil(t, err)
+	m.clock = NewHLC(node, clock)
+	return m
+}
+
+// members returns the keys and payloads of the group of a membership
+func members(m *Membership) map[string]string {
+	elements := make(map[string]string)
+	for _, element := range m.Group().GetElements() {
+		elements[element.Key] = string(element.Payload)
+	}
+	return elements
+}
+
+func TestMembership(t *testing.T) {
+	_, err := NewMembership("", NewGroup("test", 10))
+	assert.Equal(t, ErrInvalidNode, err)
+
+	group := NewGroup("test", 10)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	m, err := NewMembership("a", group)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(m.State().Tags))
+
+	assert.Nil(t, m.Add("192.168.1.101:1883", []byte("werbenhu101")))
+	assert.Nil(t, m.Add("192.168.1.101:1883", []byte("werbenhu102")))
+	assert.Equal(t, map[string]string{
+		"192.168.1.100:1883": "werbenhu100",
+		"192.168.1.101:1883": "werbenhu102",
+	}, members(m))
+	assert.Equal(t, 1, len(m.State().Removed))
+
+	assert.Nil(t, m.Remove("192.168.1.100:1883"))
+	assert.Equal(t, ErrKeyNotFound, m.Remove("192.168.1.100:1883"))
+	assert.Equal(t, map[string]string{"192.168.1.101:1883": "werbenhu102"}, members(m))
+	element, _, err := group.Match("user-id-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.1.101:1883", element)
+
+	assert.Equal(t, ErrInvalidReplicas, m.SetReplicas(0))
+	assert.Equal(t, ErrInvalidReplicas, m.SetReplicas(DefaultMaxReplicas+1))
+	assert.Nil(t, m.SetReplicas(20))
+	assert.Equal(t, 20, group.NumberOfReplicas)
+	assert.Equal(t, 20, len(group.circle))
+
+	group.markRemoved()
+	assert.Equal(t, ErrGroupRemoved, m.Add("192.168.1.102:1883", nil))
+	_, err = NewMembership("b", group)
+	assert.Equal(t, ErrGroupRemoved, err)
+}
+
+func TestMembershipMerge(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	a := newMembership(t, "a", clock)
+	b := newMembership(t, "b", clock)
+
+	// concurrent adds of the same element: the latest payload wins on both sides
+	a.Add("192.168.1.100:1883", []byte("a"))
+	clock.Advance(time.Second)
+	b.Add("192.168.1.100:1883", []byte("b"))
+	assert.Nil(t, a.Merge(b))
+	assert.Nil(t, b.Merge(a))
+	assert.Equal(t, map[string]string{"192.168.1.100:1883": "b"}, members(a))
+	assert.Equal(t, members(a), members(b))
+
+	// a remove only removes what it has seen, a concurrent add wins
+	b.Remove("192.168.1.100:1883")
+	a.Add("192.168.1.100:1883", []byte("a2"))
+	assert.Nil(t, a.Merge(b))
+	assert.Nil(t, b.Merge(a))
+	assert.Equal(t, map[string]string{"192.168.1.100:1883": "a2"}, members(a))
+	assert.Equal(t, members(a), members(b))
+
+	// a remove of everything seen removes the element everywhere
+	b.Remove("192.168.1.100:1883")
+	assert.Nil(t, a.Merge(b))
+	assert.Equal(t, map[string]string{}, members(a))
+
+	// the later replicas wins, even when its wall clock is behind
+	a.SetReplicas(50)
+	clock.Advance(-time.Hour)
+	b.Merge(a)
+	b.SetReplicas(20)
+	a.Merge(b)
+	assert.Equal(t, 20, a.Group().NumberOfReplicas)
+	assert.Equal(t, 20, b.Group().NumberOfReplicas)
+
+	// merging is idempotent
+	state := a.State()
+	assert.Nil(t, a.Merge(b))
+	assert.Nil(t, a.Merge(a))
+	assert.Equal(t, state, a.State())
+}
+
+func TestMembershipConvergence(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	nodes := []*Membership{
+		newMembership(t, "a", clock),
+		newMembership(t, "b", clock),
+		newMembership(t, "c", clock),
+	}
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		for _, node := range nodes {
+			for i := 0; i < 10; i++ {
+				key := "192.168.1." + strconv.Itoa(r.Intn(20)) + ":1883"
+				switch r.Intn(4) {
+				case 0:
+					node.Remove(key)
+				case 1:
+					node.SetReplicas(1 + r.Intn(30))
+				default:
+					node.Add(key, []byte(strconv.Itoa(r.Intn(3))))
+				}
+				clock.Advance(time.Duration(r.Intn(3)-1) * time.Millisecond)
+			}
+		}
+		// partial exchanges between random pairs while partitioned
+		from, to := nodes[r.Intn(3)], nodes[r.Intn(3)]
+		assert.Nil(t, to.Merge(from))
+	}
+
+	// exchange states in different orders until every node has seen every change
+	nodes[0].Merge(nodes[2])
+	nodes[1].Merge(nodes[0])
+	nodes[2].Merge(nodes[1])
+	nodes[0].Merge(nodes[2])
+
+	expected := nodes[0].Group().ring()
+	for _, node := range nodes[1:] {
+		assert.Equal(t, nodes[0].State(), node.State())
+		assert.Equal(t, members(nodes[0]), members(node))
+		assert.Equal(t, nodes[0].Group().Fingerprint(), node.Group().Fingerprint())
+		assert.Equal(t, expected, node.Group().ring())
+	}
+	assert.True(t, len(expected.points) > 0)
+
+	// a group rebuilt from scratch from the merged state has the same ring
+	data, err := json.Marshal(nodes[0].State())
+	assert.Nil(t, err)
+	var state MembershipState
+	assert.Nil(t, json.Unmarshal(data, &state))
+	fresh := newMembership(t, "d", clock)
+	assert.Nil(t, fresh.MergeState(state))
+	assert.Equal(t, expected, fresh.Group().ring())
+	assert.Equal(t, nodes[0].Group().Fingerprint(), fresh.Group().Fingerprint())
+}
+
+func TestMembershipInvalidState(t *testing.T) {
+	m := newMembership(t, "a", nil)
+	assert.Equal(t, ErrInvalidMembership, m.MergeState(MembershipState{}))
+	assert.Equal(t, ErrInvalidMembership, m.MergeState(MembershipState{
+		Replicas: ReplicasRegister{Value: 10},
+		Tags:     []Tag{{Key: "", Time: Timestamp{Wall: 1, Node: "b"}}},
+	}))
+	assert.Equal(t, ErrInvalidMembership, m.MergeState(MembershipState{
+		Replicas: ReplicasRegister{Value: 10},
+		Tags:     []Tag{{Key: "192.168.1.100:1883", Time: Timestamp{Wall: 1}}},
+	}))
+	assert.Equal(t, ErrInvalidMembership, m.MergeState(MembershipState{
+		Replicas: ReplicasRegister{Value: 1 << 40, Time: Timestamp{Wall: 1, Node: "b"}},
+	}))
+	assert.Equal(t, 10, m.Group().NumberOfReplicas)
+}
+
+func TestMembershipTooManyPoints(t *testing.T) {
+	m := newMembership(t, "a", nil)
+	for i := 0; i < 11; i++ {
+		assert.Nil(t, m.Add("192.168.1."+strconv.Itoa(100+i)+":1883", nil))
+	}
+	ring := m.Group().ring()
+	fingerprint := m.Group().Fingerprint()
+
+	tags := make([]Tag, 0, 50)
+	for i := 0; i < 50; i++ {
+		tags = append(tags, Tag{Key: "192.168.2." + strconv.Itoa(i) + ":1883", Time: Timestamp{Wall: 1, Node: "b"}})
+	}
+	assert.Equal(t, ErrInvalidMembership, m.MergeState(MembershipState{
+		Replicas: ReplicasRegister{Value: DefaultMaxReplicas, Time: Timestamp{Wall: 1, Node: "b"}},
+		Tags:     tags,
+	}))
+	// valid on its own, but too large together with the local members
+	assert.Equal(t, ErrTooManyPoints, m.MergeState(MembershipState{
+		Replicas: ReplicasRegister{Value: DefaultMaxReplicas, Time: m.clock.Now()},
+	}))
+	assert.Equal(t, ErrTooManyPoints, m.SetReplicas(DefaultMaxReplicas))
+	assert.Equal(t, 10, m.State().Replicas.Value)
+	assert.Equal(t, ring, m.Group().ring())
+	assert.Equal(t, fingerprint, m.Group().Fingerprint())
+
+	assert.Nil(t, m.Remove("192.168.1.110:1883"))
+	m.replicas.Value = DefaultMaxReplicas
+	assert.Equal(t, ErrTooManyPoints, m.Add("192.168.1.110:1883", nil))
+	assert.Len(t, m.State().Tags, 10)
+}
+
+func TestMembershipSeedCollision(t *testing.T) {
+	// node-9995 and node-1884240 share a point at 10 replicas, the seed inserts them unsorted
+	seed := NewGroup("test", 10)
+	seed.Insert("node-9995", nil)
+	seed.Insert("node-1884240", nil)
+	a, err := NewMembership("a", seed)
+	assert.Nil(t, err)
+	b := newMembership(t, "b", nil)
+
+	assert.Nil(t, b.Merge(a))
+	assert.Nil(t, a.Merge(b))
+	assert.Equal(t, a.Group().Fingerprint(), b.Group().Fingerprint())
+	assert.Equal(t, a.Group().ring(), b.Group().ring())
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// MetricsContentType is the content type of the Prometheus text exposition format
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// countMatch counts a Match result of an element without taking the group lock,
+// and the lookup key if instrumentation is enabled
+func (b *Group) countMatch(key string, element *Element) {
+	if counter := b.matches[element.Key]; counter != nil {
+		atomic.AddUint64(counter, 1)
+	}
+	if b.hot != nil {
+		b.hot.record(key)
+	}
+}
+
+// elementMetrics are the metrics of a single element
+type elementMetrics struct {
+	key       string
+	ownership float64
+	matches   uint64
+}
+
+// groupMetrics are the metrics of a single group
+type groupMetrics struct {
+	name      string
+	points    int
+	elements  []elementMetrics
+	mutations map[EventType]uint64
+}
+
+// collectMetrics reads the metrics of the group under the group lock
+func (b *Group) collectMetrics() groupMetrics {
+	b.RLock()
+	defer b.RUnlock()
+
+	r := b.snapshotRing()
+	owned := r.ownership()
+	m := groupMetrics{
+		name:      b.Name,
+		points:    len(r.points),
+		elements:  make([]elementMetrics, 0, len(b.Elements)),
+		mutations: make(map[EventType]uint64, len(b.mutations)),
+	}
+	for key := range b.Elements {
+		em := elementMetrics{key: key, ownership: owned[key]}
+		if counter := b.matches[key]; counter != nil {
+			em.matches = atomic.LoadUint64(counter)
+		}
+		m.elements = append(m.elements, em)
+	}
+	sort.Slice(m.elements, func(i, j int) bool {
+		return m.elements[i].key < m.elements[j].key
+	})
+	for t, n := range b.mutations {
+		m.mutations[t] = n
+	}
+	return m
+}
+
+// labelEscaper escapes label values as required by the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricsWriter writes metric families in the Prometheus text format
+type metricsWriter struct {
+	*bufio.Writer
+}
+
+// family writes the HELP and TYPE lines of a metric family
+func (w metricsWriter) family(name string, typ string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a single sample, labels are given as name, value pairs
+func (w metricsWriter) sample(name string, value string, labels ...string) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+// WriteMetrics writes the metrics of the CHash and all its groups
+// in the Prometheus text exposition format
+func WriteMetrics(out io.Writer, c *CHash) error {
+	groups := make([]groupMetrics, 0)
+	for _, group := range c.GetGroups() {
+		groups = append(groups, group.collectMetrics())
+	}
+	c.restores.Lock()
+	restores, restoreErrors, restoreSeconds := c.restores.count, c.restores.errors, c.restores.seconds
+	c.restores.Unlock()
+
+	w := metricsWriter{bufio.NewWriter(out)}
+	w.family("chash_groups", "gauge", "Number of groups.")
+	w.sample("chash_groups", strconv.Itoa(len(groups)))
+
+	w.family("chash_changes_total", "counter", "Number of changes of the registry and all its groups.")
+	w.sample("chash_changes_total", strconv.FormatUint(c.Version(), 10))
+
+	w.family("chash_restore_duration_seconds", "summary", "Duration of successful restores.")
+	w.sample("chash_restore_duration_seconds_sum", formatFloat(restoreSeconds))
+	w.sample("chash_restore_duration_seconds_count", strconv.FormatUint(restores, 10))
+
+	w.family("chash_restore_errors_total", "counter", "Number of failed restores.")
+	w.sample("chash_restore_errors_total", strconv.FormatUint(restoreErrors, 10))
+
+	w.family("chash_group_elements", "gauge", "Number of elements of a group.")
+	for _, g := range groups {
+		w.sample("chash_group_elements", strconv.Itoa(len(g.elements)), "group", g.name)
+	}
+
+	w.family("chash_group_ring_points", "gauge", "Number of distinct points on the circle of a group.")
+	for _, g := range groups {
+		w.sample("chash_group_ring_points", strconv.Itoa(g.points), "group", g.name)
+	}
+
+	w.family("chash_group_mutations_total", "counter", "Number of changes of a group by type.")
+	for _, g := range groups {
+		types := make([]int, 0, len(g.mutations))
+		for t := range g.mutations {
+			types = append(types, int(t))
+		}
+		sort.Ints(types)
+		for _, t := range types {
+			w.sample("chash_group_mutations_total", strconv.FormatUint(g.mutations[EventType(t)], 10), "group", g.name, "type", EventType(t).String())
+		}
+	}
+
+	w.family("chash_element_ownership_ratio", "gauge", "Fraction of the keyspace owned by an element.")
+	for _, g := range groups {
+		for _, e := range g.elements {
+			w.sample("chash_element_ownership_ratio", formatFloat(e.ownership), "group", g.name, "element", e.key)
+		}
+	}
+
+	w.family("chash_element_matches_total", "counter", "Number of keys matched to an element.")
+	for _, g := range groups {
+		for _, e := range g.elements {
+			w.sample("chash_element_matches_total", strconv.FormatUint(e.matches, 10), "group", g.name, "element", e.key)
+		}
+	}
+	return w.Flush()
+}
+
+// MetricsHandler returns an http.Handler serving the metrics of the CHash
+// in the Prometheus text exposition format
+func MetricsHandler(c *CHash) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MetricsContentType)
+		WriteMetrics(w, c)
+	})
+}
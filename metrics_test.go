@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupMatchCounters(t *testing.T) {
+	hash := New()
+	hash.Restore([]byte(`{"test":{"name":"test","numberOfReplicas":10,"elements":{"a":{"key":"a"}}}}`))
+	group, _ := hash.GetGroup("test")
+
+	group.Match("user-id-1")
+	group.Upsert("a", []byte("werben"))
+	group.Match("user-id-2")
+	assert.Equal(t, uint64(2), *group.matches["a"])
+
+	hash.Restore([]byte(`{"test":{"name":"test","numberOfReplicas":10,"elements":{"a":{"key":"a"},"b":{"key":"b"}}}}`))
+	assert.Equal(t, uint64(2), *group.matches["a"])
+	assert.Equal(t, uint64(0), *group.matches["b"])
+
+	group.Delete("a")
+	assert.Nil(t, group.matches["a"])
+}
+
+func TestWriteMetrics(t *testing.T) {
+	hash := New()
+	db, _ := hash.CreateGroup("db", 10)
+	db.Insert("a", nil)
+	db.Insert(`b"\`, nil)
+	db.Upsert("a", nil)
+	db.Match("user-id-1")
+	hash.CreateGroup("empty", 10)
+	hash.Restore([]byte(`--`))
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteMetrics(&buf, hash))
+	out := buf.String()
+
+	assert.Contains(t, out, "# HELP chash_groups Number of groups.\n# TYPE chash_groups gauge\nchash_groups 2\n")
+	assert.Contains(t, out, "chash_changes_total 5\n")
+	assert.Contains(t, out, "chash_restore_duration_seconds_count 0\n")
+	assert.Contains(t, out, "chash_restore_errors_total 1\n")
+	assert.Contains(t, out, "chash_group_elements{group=\"db\"} 2\nchash_group_elements{group=\"empty\"} 0\n")
+	assert.Contains(t, out, "chash_group_ring_points{group=\"db\"} 20\n")
+	assert.Contains(t, out, "chash_group_mutations_total{group=\"db\",type=\"element_added\"} 2\nchash_group_mutations_total{group=\"db\",type=\"payload_updated\"} 1\n")
+	assert.Contains(t, out, "chash_element_ownership_ratio{group=\"db\",element=\"b\\\"\\\\\"} ")
+
+	matched, _, _ := db.Match("user-id-1")
+	if matched == "a" {
+		assert.Contains(t, out, "chash_element_matches_total{group=\"db\",element=\"a\"} 1\n")
+	} else {
+		assert.Contains(t, out, "chash_element_matches_total{group=\"db\",element=\"a\"} 0\n")
+	}
+
+	families := 0
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			families++
+		}
+	}
+	assert.Equal(t, 9, families)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	hash := New()
+	hash.Restore([]byte(`{"db":{"name":"db","numberOfReplicas":10}}`))
+
+	w := httptest.NewRecorder()
+	MetricsHandler(hash).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, MetricsContentType, w.Header().Get("Content-Type"))
+
+	body, _ := ioutil.ReadAll(w.Body)
+	assert.Contains(t, string(body), "chash_restore_duration_seconds_count 1\n")
+	assert.Contains(t, string(body), "# TYPE chash_restore_duration_seconds summary\n")
+}
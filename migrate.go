@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"context"
+	"sort"
+)
+
+// DefaultMoveBatchSize is the batch size used when MoveOptions.BatchSize is not set.
+const DefaultMoveBatchSize = 100
+
+// KeyIterator iterates over the keys of stored data, in the style of bufio.Scanner.
+// Next advances to the next key and returns false when there are no more keys
+// or an error occurred, which is then reported by Err.
+type KeyIterator interface {
+	Next() bool
+	Key() string
+	Err() error
+}
+
+// sliceIterator is a KeyIterator over a slice of keys
+type sliceIterator struct {
+	keys []string
+	pos  int
+}
+
+// NewSliceIterator returns a KeyIterator over the given keys
+func NewSliceIterator(keys []string) KeyIterator {
+	return &sliceIterator{keys: keys}
+}
+
+// Next advances to the next key
+func (it *sliceIterator) Next() bool {
+	if it.pos >= len(it.keys) {
+		return false
+	}
+	it.pos++
+	return true
+}
+
+// Key returns the current key
+func (it *sliceIterator) Key() string {
+	return it.keys[it.pos-1]
+}
+
+// Err always returns nil
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+// MoveBatch is a batch of keys that move from one element to another.
+// From is empty if the old ring has no elements, To if the new one has none.
+type MoveBatch struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Keys []string `json:"keys"`
+}
+
+// MoveProgress counts the keys handled so far
+type MoveProgress struct {
+	// Scanned is the number of keys read from the iterator.
+	Scanned int `json:"scanned"`
+
+	// Moved is the number of keys whose owner changes and that were emitted in batches.
+	Moved int `json:"moved"`
+
+	// Batches is the number of batches emitted.
+	Batches int `json:"batches"`
+}
+
+// MoveOptions configures PlanMoves
+type MoveOptions struct {
+	// BatchSize is the maximum number of keys in a batch.
+	BatchSize int
+
+	// Progress, if set, is called after every emitted batch.
+	Progress func(MoveProgress)
+}
+
+// movePair identifies the source and destination of a batch
+type movePair struct {
+	from string
+	to   string
+}
+
+// PlanMoves matches every key of the iterator against the circles of from and to
+// and streams the keys whose owner changes to fn, in batches that share the same
+// source and destination. Both circles are read once before the first key,
+// so changes made to the groups while planning do not mix two states.
+//
+// A batch is emitted as soon as it is full, the remaining partial batches are
+// emitted at the end ordered by source and destination. Planning stops with
+// the first error returned by fn or the iterator, or when ctx is done.
+func PlanMoves(ctx context.Context, from, to *Group, keys KeyIterator, opts MoveOptions, fn func(MoveBatch) error) (MoveProgress, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultMoveBatchSize
+	}
+	oldRing, newRing := from.ring(), to.ring()
+
+	progress := MoveProgress{}
+	pending := make(map[movePair][]string)
+	flush := func(pair movePair) error {
+		batch := MoveBatch{From: pair.from, To: pair.to, Keys: pending[pair]}
+		delete(pending, pair)
+		if err := fn(batch); err != nil {
+			return err
+		}
+		progress.Moved += len(batch.Keys)
+		progress.Batches++
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		return nil
+	}
+
+	for keys.Next() {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		key := keys.Key()
+		progress.Scanned++
+
+		crc := from.hash(key)
+		pair := movePair{from: oldRing.owner(crc), to: newRing.owner(crc)}
+		if pair.from == pair.to {
+			continue
+		}
+		pending[pair] = append(pending[pair], key)
+		if len(pending[pair]) >= batchSize {
+			if err := flush(pair); err != nil {
+				return progress, err
+			}
+		}
+	}
+	if err := keys.Err(); err != nil {
+		return progress, err
+	}
+
+	pairs := make([]movePair, 0, len(pending))
+	for pair := range pending {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].from != pairs[j].from {
+			return pairs[i].from < pairs[j].from
+		}
+		return pairs[i].to < pairs[j].to
+	})
+	for _, pair := range pairs {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		if err := flush(pair); err != nil {
+			return progress, err
+		}
+	}
+	return progress, nil
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingIterator yields a few keys and then fails
+type failingIterator struct {
+	n int
+}
+
+func (it *failingIterator) Next() bool  { it.n++; return it.n <= 3 }
+func (it *failingIterator) Key() string { return fmt.Sprintf("user-id-%d", it.n) }
+func (it *failingIterator) Err() error  { return errors.New("read failed") }
+
+func newMigrationGroups() (*Group, *Group, []string) {
+	from := NewGroup("test", 100)
+	from.Insert("192.168.1.100:1883", nil)
+	from.Insert("192.168.1.101:1883", nil)
+	to := from.Clone()
+	to.Insert("192.168.1.102:1883", nil)
+
+	keys := make([]string, 0)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("user-id-%d", i))
+	}
+	return from, to, keys
+}
+
+func TestSliceIterator(t *testing.T) {
+	it := NewSliceIterator([]string{"a", "b"})
+	assert.True(t, it.Next())
+	assert.Equal(t, "a", it.Key())
+	assert.True(t, it.Next())
+	assert.Equal(t, "b", it.Key())
+	assert.False(t, it.Next())
+	assert.Nil(t, it.Err())
+}
+
+func TestPlanMoves(t *testing.T) {
+	from, to, keys := newMigrationGroups()
+
+	expected := 0
+	for _, key := range keys {
+		src, _, _ := from.Match(key)
+		dst, _, _ := to.Match(key)
+		if src != dst {
+			expected++
+		}
+	}
+
+	batches := make([]MoveBatch, 0)
+	reports := 0
+	progress, err := PlanMoves(context.Background(), from, to, NewSliceIterator(keys), MoveOptions{
+		BatchSize: 50,
+		Progress:  func(MoveProgress) { reports++ },
+	}, func(batch MoveBatch) error {
+		batches = append(batches, batch)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, progress.Scanned)
+	assert.Equal(t, expected, progress.Moved)
+	assert.Equal(t, len(batches), progress.Batches)
+	assert.Equal(t, len(batches), reports)
+
+	moved := 0
+	for _, batch := range batches {
+		assert.True(t, len(batch.Keys) <= 50)
+		assert.Equal(t, "192.168.1.102:1883", batch.To)
+		for _, key := range batch.Keys {
+			src, _, _ := from.Match(key)
+			dst, _, _ := to.Match(key)
+			assert.Equal(t, src, batch.From)
+			assert.Equal(t, dst, batch.To)
+		}
+		moved += len(batch.Keys)
+	}
+	assert.Equal(t, expected, moved)
+}
+
+func TestPlanMovesDefaultBatchSize(t *testing.T) {
+	from, to, keys := newMigrationGroups()
+	_, err := PlanMoves(context.Background(), from, to, NewSliceIterator(keys), MoveOptions{}, func(batch MoveBatch) error {
+		assert.True(t, len(batch.Keys) <= DefaultMoveBatchSize)
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestPlanMovesErrors(t *testing.T) {
+	from, to, keys := newMigrationGroups()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	progress, err := PlanMoves(ctx, from, to, NewSliceIterator(keys), MoveOptions{}, func(MoveBatch) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, progress.Scanned)
+
+	failed := errors.New("move failed")
+	progress, err = PlanMoves(context.Background(), from, to, NewSliceIterator(keys), MoveOptions{BatchSize: 1}, func(MoveBatch) error {
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	assert.Equal(t, 0, progress.Batches)
+
+	_, err = PlanMoves(context.Background(), from, to, &failingIterator{}, MoveOptions{}, func(MoveBatch) error {
+		return nil
+	})
+	assert.Equal(t, "read failed", err.Error())
+}
@@ -0,0 +1,357 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Content types of the rendered rings
+const (
+	SVGContentType = "image/svg+xml"
+	DOTContentType = "text/vnd.graphviz"
+)
+
+// DefaultRenderSize is the width of the ring area of a rendered SVG in pixels
+const DefaultRenderSize = 480
+
+// RenderOptions configures RenderSVG and RenderDOT
+type RenderOptions struct {
+	// Keys are lookup keys whose owners are highlighted.
+	Keys []string
+
+	// Before is the group before a membership change. When set, its circle is drawn
+	// inside the circle of the rendered group and the arcs whose owner changed are marked.
+	Before *Group
+
+	// Size is the width of the SVG ring area in pixels, 0 meaning DefaultRenderSize.
+	// It is not used by RenderDOT.
+	Size int
+}
+
+// segment is a range [start, end) of the keyspace owned by one element
+type segment struct {
+	start uint64
+	end   uint64
+	owner string
+}
+
+// renderKey is a highlighted lookup key
+type renderKey struct {
+	key      string
+	position uint32
+	owner    string
+	previous string
+}
+
+// renderView is a consistent view of the rings to render
+type renderView struct {
+	name      string
+	replicas  int
+	members   int
+	after     ring
+	before    *ring
+	diff      *RingDiff
+	elements  []string
+	ownership map[string]float64
+	previous  map[string]float64
+	keys      []renderKey
+}
+
+// segments merges the arcs of neighbouring points with the same owner,
+// starting at position 0 so the wrapping arc is split in two
+func (r ring) segments() []segment {
+	if len(r.points) == 0 {
+		return nil
+	}
+	last := len(r.points) - 1
+	segs := make([]segment, 0)
+	add := func(start, end uint64, owner string) {
+		if start == end {
+			return
+		}
+		if n := len(segs); n > 0 && segs[n-1].owner == owner {
+			segs[n-1].end = end
+			return
+		}
+		segs = append(segs, segment{start: start, end: end, owner: owner})
+	}
+	add(0, uint64(r.points[0]), r.owners[last])
+	for i := range r.points {
+		end := keyspace
+		if i < last {
+			end = uint64(r.points[i+1])
+		}
+		add(uint64(r.points[i]), end, r.owners[i])
+	}
+	return segs
+}
+
+// renderSnapshot reads the group, and the group before the change if any, under their own locks
+func renderSnapshot(group *Group, opts RenderOptions) (*renderView, error) {
+	group.RLock()
+	if group.removed {
+		group.RUnlock()
+		return nil, ErrGroupRemoved
+	}
+	view := &renderView{name: group.Name, replicas: group.NumberOfReplicas, after: group.snapshotRing()}
+	view.members = len(group.Elements)
+	members := make(map[string]bool, len(group.Elements))
+	for key := range group.Elements {
+		members[key] = true
+	}
+	group.RUnlock()
+
+	if opts.Before != nil {
+		opts.Before.RLock()
+		if opts.Before.removed {
+			opts.Before.RUnlock()
+			return nil, ErrGroupRemoved
+		}
+		before := opts.Before.snapshotRing()
+		for key := range opts.Before.Elements {
+			members[key] = true
+		}
+		opts.Before.RUnlock()
+		view.before = &before
+		view.diff = diffRings(before, view.after)
+		view.previous = before.ownership()
+	}
+
+	for key := range members {
+		view.elements = append(view.elements, key)
+	}
+	sort.Strings(view.elements)
+	view.ownership = view.after.ownership()
+
+	for _, key := range opts.Keys {
+		rk := renderKey{key: key, position: group.hash(key)}
+		rk.owner = view.after.owner(rk.position)
+		if view.before != nil {
+			rk.previous = view.before.owner(rk.position)
+		}
+		view.keys = append(view.keys, rk)
+	}
+	return view, nil
+}
+
+// hue returns the hue of the i-th of n elements as a fraction of the colour wheel
+func hue(i, n int) float64 {
+	return float64(i) / float64(n)
+}
+
+// title describes the rendered group in a single line
+func (v *renderView) title() string {
+	s := fmt.Sprintf("group %s: %d elements, %d replicas", v.name, v.members, v.replicas)
+	if v.diff != nil {
+		s += fmt.Sprintf(", %.2f%% moved", v.diff.Moved*100)
+	}
+	return s
+}
+
+// share formats the ownership of an element, with its ownership before the change if any
+func (v *renderView) share(key string) string {
+	s := fmt.Sprintf("%.2f%%", v.ownership[key]*100)
+	if v.previous != nil {
+		s += fmt.Sprintf(" (was %.2f%%)", v.previous[key]*100)
+	}
+	return s
+}
+
+// escapeXML escapes s for use in SVG text and attributes
+func escapeXML(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// orNone names the owner of a key on an empty ring
+func orNone(owner string) string {
+	if owner == "" {
+		return "none"
+	}
+	return owner
+}
+
+// svgCanvas converts keyspace positions to points on the SVG
+type svgCanvas struct {
+	w      *bufio.Writer
+	cx, cy float64
+}
+
+// point returns the coordinates of a position at radius r, position 0 being at
+// the top of the circle and positions increasing clockwise
+func (c svgCanvas) point(position uint64, r float64) (float64, float64) {
+	angle := 2 * math.Pi * float64(position) / float64(keyspace)
+	return c.cx + r*math.Sin(angle), c.cy - r*math.Cos(angle)
+}
+
+// arc draws the range [start, end) as a band of the given width centred on radius r
+func (c svgCanvas) arc(start, end uint64, r, width float64, color string) {
+	if end-start >= keyspace {
+		fmt.Fprintf(c.w, `<circle cx="%.2f" cy="%.2f" r="%.2f" fill="none" stroke="%s" stroke-width="%.2f"/>`+"\n",
+			c.cx, c.cy, r, color, width)
+		return
+	}
+	x1, y1 := c.point(start, r)
+	x2, y2 := c.point(end, r)
+	large := 0
+	if end-start > keyspace/2 {
+		large = 1
+	}
+	fmt.Fprintf(c.w, `<path d="M %.2f %.2f A %.2f %.2f 0 %d 1 %.2f %.2f" fill="none" stroke="%s" stroke-width="%.2f"/>`+"\n",
+		x1, y1, r, r, large, x2, y2, color, width)
+}
+
+// RenderSVG draws the circle of the group as a ring with the arcs coloured by
+// their owning element, a legend with the ownership of each element and
+// markers for the highlighted keys. With opts.Before set, the circle before
+// the change is drawn as an inner ring and the arcs that moved between them in red.
+func RenderSVG(w io.Writer, group *Group, opts RenderOptions) error {
+	view, err := renderSnapshot(group, opts)
+	if err != nil {
+		return err
+	}
+	size := opts.Size
+	if size <= 0 {
+		size = DefaultRenderSize
+	}
+	s := float64(size)
+	const header, line = 30.0, 20.0
+	width := s
+	height := header + s + line*float64(len(view.elements)) + line/2
+
+	colors := make(map[string]string, len(view.elements))
+	for i, key := range view.elements {
+		colors[key] = fmt.Sprintf("hsl(%.0f,65%%,55%%)", hue(i, len(view.elements))*360)
+	}
+
+	bw := bufio.NewWriter(w)
+	c := svgCanvas{w: bw, cx: s / 2, cy: header + s/2}
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(bw, "<title>%s</title>\n", escapeXML(view.title()))
+	fmt.Fprintf(bw, `<text x="%.2f" y="20" text-anchor="middle" font-size="14">%s</text>`+"\n", s/2, escapeXML(view.title()))
+
+	fmt.Fprintf(bw, `<g class="after">`+"\n")
+	for _, seg := range view.after.segments() {
+		c.arc(seg.start, seg.end, s*0.38, s*0.05, colors[seg.owner])
+	}
+	fmt.Fprintf(bw, "</g>\n")
+	if view.before != nil {
+		fmt.Fprintf(bw, `<g class="before">`+"\n")
+		for _, seg := range view.before.segments() {
+			c.arc(seg.start, seg.end, s*0.26, s*0.05, colors[seg.owner])
+		}
+		fmt.Fprintf(bw, "</g>\n")
+		fmt.Fprintf(bw, `<g class="moved">`+"\n")
+		for _, moved := range view.diff.Arcs {
+			c.arc(moved.Start, moved.End, s*0.32, s*0.02, "#d62728")
+		}
+		fmt.Fprintf(bw, "</g>\n")
+	}
+
+	fmt.Fprintf(bw, `<g class="keys">`+"\n")
+	for _, key := range view.keys {
+		x1, y1 := c.point(uint64(key.position), s*0.2)
+		x2, y2 := c.point(uint64(key.position), s*0.44)
+		anchor := "start"
+		if x2 < c.cx {
+			anchor = "end"
+		}
+		label := key.key
+		if view.before != nil && key.previous != key.owner {
+			label += " → " + orNone(key.previous)
+		}
+		label += " → " + orNone(key.owner)
+		fmt.Fprintf(bw, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="#333"/>`+"\n", x1, y1, x2, y2)
+		fmt.Fprintf(bw, `<circle cx="%.2f" cy="%.2f" r="3" fill="#333"/>`+"\n", x2, y2)
+		fmt.Fprintf(bw, `<text x="%.2f" y="%.2f" text-anchor="%s">%s</text>`+"\n", x2, y2-6, anchor, escapeXML(label))
+	}
+	fmt.Fprintf(bw, "</g>\n")
+
+	fmt.Fprintf(bw, `<g class="legend">`+"\n")
+	for i, key := range view.elements {
+		y := header + s + line*float64(i)
+		fmt.Fprintf(bw, `<rect x="10" y="%.2f" width="12" height="12" fill="%s"/>`+"\n", y, colors[key])
+		fmt.Fprintf(bw, `<text x="28" y="%.2f">%s %s</text>`+"\n", y+10, escapeXML(key), view.share(key))
+	}
+	fmt.Fprintf(bw, "</g>\n</svg>\n")
+	return bw.Flush()
+}
+
+// quoteDOT quotes s as a Graphviz ID
+func quoteDOT(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "").Replace(s)
+	return `"` + s + `"`
+}
+
+// RenderDOT writes the group as a Graphviz digraph: a node per element labelled
+// with its ownership and an edge from every highlighted key to its owner.
+// With opts.Before set, keys that moved also get a dashed edge to their previous
+// owner, and an edge between two elements carries the share of the keyspace moved from one to the other.
+func RenderDOT(w io.Writer, group *Group, opts RenderOptions) error {
+	view, err := renderSnapshot(group, opts)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", quoteDOT(view.name))
+	fmt.Fprintf(bw, "\tlabel=%s;\n", quoteDOT(view.title()))
+	fmt.Fprintf(bw, "\tnode [shape=box, style=filled];\n")
+	for i, key := range view.elements {
+		style := "filled"
+		if _, ok := view.ownership[key]; !ok {
+			style = "filled,dashed"
+		}
+		fmt.Fprintf(bw, "\t%s [label=%s, fillcolor=\"%.3f 0.450 0.950\", style=%q];\n",
+			quoteDOT("element:"+key), quoteDOT(key+"\n"+view.share(key)), hue(i, len(view.elements)), style)
+	}
+
+	for _, key := range view.keys {
+		fmt.Fprintf(bw, "\t%s [label=%s, shape=ellipse, style=solid];\n", quoteDOT("key:"+key.key), quoteDOT(key.key))
+		if key.owner != "" {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", quoteDOT("key:"+key.key), quoteDOT("element:"+key.owner))
+		}
+		if view.before != nil && key.previous != "" && key.previous != key.owner {
+			fmt.Fprintf(bw, "\t%s -> %s [style=dashed, label=\"before\"];\n", quoteDOT("key:"+key.key), quoteDOT("element:"+key.previous))
+		}
+	}
+
+	if view.diff != nil {
+		type move struct{ from, to string }
+		moved := make(map[move]uint64)
+		order := make([]move, 0)
+		for _, arc := range view.diff.Arcs {
+			if arc.From == "" || arc.To == "" {
+				continue
+			}
+			m := move{arc.From, arc.To}
+			if _, ok := moved[m]; !ok {
+				order = append(order, m)
+			}
+			moved[m] += arc.End - arc.Start
+		}
+		sort.Slice(order, func(i, j int) bool {
+			if order[i].from != order[j].from {
+				return order[i].from < order[j].from
+			}
+			return order[i].to < order[j].to
+		})
+		for _, m := range order {
+			fmt.Fprintf(bw, "\t%s -> %s [color=\"#d62728\", label=\"%.2f%%\"];\n",
+				quoteDOT("element:"+m.from), quoteDOT("element:"+m.to), float64(moved[m])/float64(keyspace)*100)
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingSegments(t *testing.T) {
+	assert.Nil(t, ring{}.segments())
+
+	single := ring{points: Circle{10}, owners: []string{"a"}}
+	assert.Equal(t, []segment{{start: 0, end: keyspace, owner: "a"}}, single.segments())
+
+	r := ring{points: Circle{10, 20, 30, 40}, owners: []string{"a", "a", "b", "a"}}
+	assert.Equal(t, []segment{
+		{start: 0, end: 30, owner: "a"},
+		{start: 30, end: 40, owner: "b"},
+		{start: 40, end: keyspace, owner: "a"},
+	}, r.segments())
+
+	zero := ring{points: Circle{0, 20}, owners: []string{"a", "b"}}
+	assert.Equal(t, []segment{
+		{start: 0, end: 20, owner: "a"},
+		{start: 20, end: keyspace, owner: "b"},
+	}, zero.segments())
+}
+
+// wellFormed reports whether data parses as XML
+func wellFormed(data []byte) bool {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := dec.Token(); err != nil {
+			return err == io.EOF
+		}
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	group := NewGroup("db<1>", 10)
+	group.Insert("192.168.1.100:3306", nil)
+	group.Insert("192.168.1.101:3306", nil)
+	owner, _, _ := group.Match("user-id-1")
+
+	var buf bytes.Buffer
+	assert.Nil(t, RenderSVG(&buf, group, RenderOptions{Keys: []string{"user-id-1"}}))
+	svg := buf.String()
+	assert.True(t, wellFormed(buf.Bytes()))
+	assert.Contains(t, svg, "group db&lt;1&gt;: 2 elements, 10 replicas")
+	assert.Contains(t, svg, "user-id-1 → "+owner)
+	assert.Contains(t, svg, `fill="hsl(0,65%,55%)"/>`)
+	assert.Contains(t, svg, `fill="hsl(180,65%,55%)"/>`)
+	assert.NotContains(t, svg, `class="before"`)
+
+	after := group.Clone()
+	after.Insert("192.168.1.102:3306", nil)
+	buf.Reset()
+	assert.Nil(t, RenderSVG(&buf, after, RenderOptions{Before: group, Size: 200}))
+	svg = buf.String()
+	assert.True(t, wellFormed(buf.Bytes()))
+	assert.Contains(t, svg, `width="200"`)
+	assert.Contains(t, svg, `class="before"`)
+	assert.Contains(t, svg, `stroke="#d62728"`)
+	assert.Contains(t, svg, "(was 0.00%)")
+
+	empty := NewGroup("empty", 10)
+	buf.Reset()
+	assert.Nil(t, RenderSVG(&buf, empty, RenderOptions{Keys: []string{"user-id-1"}}))
+	assert.Contains(t, buf.String(), "user-id-1 → none")
+
+	empty.markRemoved()
+	assert.Equal(t, ErrGroupRemoved, RenderSVG(&buf, empty, RenderOptions{}))
+	assert.Equal(t, ErrGroupRemoved, RenderSVG(&buf, group, RenderOptions{Before: empty}))
+}
+
+func TestRenderDOT(t *testing.T) {
+	group := NewGroup("db", 10)
+	group.Insert("192.168.1.100:3306", nil)
+	group.Insert(`192.168.1.101:"3306"`, nil)
+
+	var buf bytes.Buffer
+	assert.Nil(t, RenderDOT(&buf, group, RenderOptions{}))
+	dot := buf.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph \"db\" {\n"))
+	assert.Contains(t, dot, `"element:192.168.1.100:3306" [label="192.168.1.100:3306\n`)
+	assert.Contains(t, dot, `"element:192.168.1.101:\"3306\""`)
+	assert.True(t, strings.HasSuffix(dot, "}\n"))
+
+	after := group.Clone()
+	after.Delete("192.168.1.100:3306")
+	buf.Reset()
+	assert.Nil(t, RenderDOT(&buf, after, RenderOptions{Before: group, Keys: []string{"user-id-1", "user-id-2", "user-id-3"}}))
+	dot = buf.String()
+	assert.Contains(t, dot, `style="filled,dashed"`)
+	assert.Contains(t, dot, `"element:192.168.1.100:3306" -> "element:192.168.1.101:\"3306\"" [color="#d62728"`)
+	assert.Contains(t, dot, `"key:user-id-1" -> "element:192.168.1.101:\"3306\"";`)
+
+	moved := 0
+	for _, key := range []string{"user-id-1", "user-id-2", "user-id-3"} {
+		if owner, _, _ := group.Match(key); owner == "192.168.1.100:3306" {
+			moved++
+		}
+	}
+	assert.Equal(t, moved, strings.Count(dot, `[style=dashed, label="before"]`))
+}
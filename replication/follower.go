@@ -0,0 +1,299 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/werbenhu/chash"
+	"github.com/werbenhu/chash/chashrpc"
+)
+
+// Defaults of a follower, used when the corresponding FollowerOptions field is 0
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// FollowerOptions configures a Follower
+type FollowerOptions struct {
+	// MinBackoff and MaxBackoff bound the time between two connection attempts.
+	// The backoff starts at MinBackoff and doubles with every attempt that fails
+	// before anything was received.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout limits connecting and the silence of the leader, it must be
+	// longer than the heartbeat of the leader.
+	Timeout time.Duration
+
+	// MaxLineSize is the largest line read from the leader, 0 meaning DefaultMaxLineSize.
+	// It must be at least the MaxLineSize of the leader.
+	MaxLineSize int
+}
+
+// Follower keeps a read-only copy of the CHash of a leader. It implements
+// chashrpc.API, the methods that would change the copy return ErrReadOnly.
+type Follower struct {
+	addr       string
+	hash       *chash.CHash
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	timeout    time.Duration
+	maxLine    int
+
+	mu        sync.Mutex
+	leader    string
+	version   uint64
+	snapshots int
+	connected bool
+	lastErr   error
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+var _ chashrpc.API = (*Follower)(nil)
+
+// NewFollower creates a follower of the leader at the given TCP address
+func NewFollower(addr string, opts FollowerOptions) *Follower {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = opts.MinBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = DefaultMaxLineSize
+	}
+	f := &Follower{
+		addr:       addr,
+		hash:       chash.New(),
+		minBackoff: opts.MinBackoff,
+		maxBackoff: opts.MaxBackoff,
+		timeout:    opts.Timeout,
+		maxLine:    opts.MaxLineSize,
+		done:       make(chan struct{}),
+	}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	return f
+}
+
+// Start connects to the leader in a background goroutine and reconnects
+// whenever the connection fails, until Stop is called
+func (f *Follower) Start() {
+	f.startOnce.Do(func() {
+		go f.loop()
+	})
+}
+
+// Stop closes the connection and waits for the background goroutine to exit.
+// A stopped follower cannot be started again, its copy can still be read.
+func (f *Follower) Stop() {
+	f.stopOnce.Do(func() {
+		f.cancel()
+	})
+	f.startOnce.Do(func() {
+		close(f.done)
+	})
+	<-f.done
+}
+
+// Leader returns the ID of the leader the copy was taken from, empty before the first snapshot
+func (f *Follower) Leader() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.leader
+}
+
+// Version returns the version of the last entry applied to the copy
+func (f *Follower) Version() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.version
+}
+
+// Connected reports whether the follower is currently connected to the leader
+func (f *Follower) Connected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+// Err returns the error that closed the last connection, nil while connected
+func (f *Follower) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastErr
+}
+
+// loop is the background goroutine of the follower
+func (f *Follower) loop() {
+	defer close(f.done)
+	backoff := f.minBackoff
+	for {
+		received, err := f.session()
+		f.mu.Lock()
+		f.connected = false
+		f.lastErr = err
+		f.mu.Unlock()
+		if f.ctx.Err() != nil {
+			return
+		}
+
+		if received {
+			backoff = f.minBackoff
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-f.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > f.maxBackoff {
+			backoff = f.maxBackoff
+		}
+	}
+}
+
+// session connects to the leader and applies its entries until the connection fails.
+// It reports whether anything was received.
+func (f *Follower) session() (bool, error) {
+	dialer := net.Dialer{Timeout: f.timeout}
+	conn, err := dialer.DialContext(f.ctx, "tcp", f.addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-f.ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	f.mu.Lock()
+	hello := Hello{Leader: f.leader, Version: f.version}
+	f.mu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(f.timeout))
+	if err := json.NewEncoder(conn).Encode(&hello); err != nil {
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64<<10), f.maxLine)
+	received := false
+	for {
+		conn.SetReadDeadline(time.Now().Add(f.timeout))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return received, err
+			}
+			return received, io.EOF
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return received, err
+		}
+		received = true
+		if err := f.handle(&entry); err != nil {
+			return received, err
+		}
+	}
+}
+
+// handle applies an entry received from the leader. An entry that cannot be
+// applied makes the follower ask for a snapshot on the next connection.
+func (f *Follower) handle(e *Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch e.Op {
+	case OpHello:
+		f.connected = true
+		f.lastErr = nil
+		return nil
+	case OpPing:
+		return nil
+	case OpError:
+		return errorOf(e)
+	case OpSnapshot:
+		if err := apply(f.hash, e); err != nil {
+			f.leader = ""
+			return err
+		}
+		f.leader = e.Leader
+		f.version = e.Version
+		f.snapshots++
+		return nil
+	}
+	if e.Version != f.version+1 {
+		f.leader = ""
+		return ErrOutOfOrder
+	}
+	if err := apply(f.hash, e); err != nil {
+		f.leader = ""
+		return err
+	}
+	f.version = e.Version
+	return nil
+}
+
+// GetGroup returns a detached copy of a group, changing it does not change the follower
+func (f *Follower) GetGroup(groupName string) (*chash.Group, error) {
+	group, err := f.hash.GetGroup(groupName)
+	if err != nil {
+		return nil, err
+	}
+	return group.Clone(), nil
+}
+
+// Match returns the element and payload of the key in the copy of the group
+func (f *Follower) Match(groupName string, key string) (string, []byte, error) {
+	return f.hash.Match(groupName, key)
+}
+
+// Serialize returns a snapshot of the copy
+func (f *Follower) Serialize() ([]byte, error) {
+	return f.hash.Serialize()
+}
+
+// CreateGroup returns ErrReadOnly, groups are created on the leader
+func (f *Follower) CreateGroup(groupName string, replicas int) (*chash.Group, error) {
+	return nil, ErrReadOnly
+}
+
+// Insert returns ErrReadOnly, elements are inserted on the leader
+func (f *Follower) Insert(groupName string, key string, payload []byte) error {
+	return ErrReadOnly
+}
+
+// Delete returns ErrReadOnly, elements are deleted on the leader
+func (f *Follower) Delete(groupName string, key string) error {
+	return ErrReadOnly
+}
+
+// Restore returns ErrReadOnly, snapshots are restored on the leader
+func (f *Follower) Restore(data []byte) error {
+	return ErrReadOnly
+}
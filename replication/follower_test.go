@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package replication
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+// converged waits until the follower holds the same groups as the CHash
+func converged(t *testing.T, follower *Follower, hash *chash.CHash) {
+	t.Helper()
+	expected, _ := hash.Serialize()
+	waitFor(t, func() bool {
+		data, _ := follower.Serialize()
+		return string(data) == string(expected)
+	})
+}
+
+func TestFollower(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 100)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	leader := NewLeader(hash, LeaderOptions{})
+	defer leader.Close()
+	addr := listen(t, leader)
+
+	follower := NewFollower(addr, FollowerOptions{MinBackoff: time.Millisecond})
+	follower.Start()
+	defer follower.Stop()
+	converged(t, follower, hash)
+	waitFor(t, follower.Connected)
+	assert.Equal(t, leader.ID(), follower.Leader())
+
+	db.Insert("192.168.1.101:3306", []byte("mysql1"))
+	hash.CreateGroup("redis", 10)
+	hash.Insert("redis", "192.168.1.100:6379", nil)
+	hash.Restore([]byte(`{"db":{"name":"db","numberOfReplicas":50,"elements":{"192.168.1.102:3306":{"key":"192.168.1.102:3306"}}}}`))
+	converged(t, follower, hash)
+	assert.Equal(t, leader.Version(), follower.Version())
+
+	expected, _, _ := hash.Match("db", "user-id-1")
+	element, _, err := follower.Match("db", "user-id-1")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, element)
+}
+
+func TestFollowerReadOnly(t *testing.T) {
+	follower := NewFollower("127.0.0.1:0", FollowerOptions{})
+	follower.hash.CreateGroup("db", 10)
+
+	_, err := follower.CreateGroup("redis", 10)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Equal(t, ErrReadOnly, follower.Insert("db", "192.168.1.100:3306", nil))
+	assert.Equal(t, ErrReadOnly, follower.Delete("db", "192.168.1.100:3306"))
+	assert.Equal(t, ErrReadOnly, follower.Restore([]byte(`{}`)))
+
+	group, err := follower.GetGroup("db")
+	assert.Nil(t, err)
+	group.Insert("192.168.1.100:3306", nil)
+	_, _, err = follower.Match("db", "user-id-1")
+	assert.Equal(t, chash.ErrNoResultMatched, err)
+	_, err = follower.GetGroup("redis")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+	follower.Stop()
+}
+
+func TestFollowerReconnect(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 10)
+	leader := NewLeader(hash, LeaderOptions{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	go leader.Serve(ln)
+
+	follower := NewFollower(addr, FollowerOptions{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	follower.Start()
+	defer follower.Stop()
+	converged(t, follower, hash)
+
+	// the connection drops while the leader keeps running, the follower resumes
+	ln.Close()
+	leader.mu.Lock()
+	for conn := range leader.conns {
+		conn.Close()
+	}
+	leader.mu.Unlock()
+	waitFor(t, func() bool { return !follower.Connected() })
+	db.Insert("192.168.1.100:3306", nil)
+
+	ln, err = net.Listen("tcp", addr)
+	assert.Nil(t, err)
+	go leader.Serve(ln)
+	converged(t, follower, hash)
+	assert.Equal(t, leader.ID(), follower.Leader())
+	follower.mu.Lock()
+	assert.Equal(t, 1, follower.snapshots)
+	follower.mu.Unlock()
+
+	// a restarted leader has a new ID, so the follower is bootstrapped again
+	leader.Close()
+	db.Insert("192.168.1.101:3306", nil)
+	restarted := NewLeader(hash, LeaderOptions{})
+	defer restarted.Close()
+	ln, err = net.Listen("tcp", addr)
+	assert.Nil(t, err)
+	go restarted.Serve(ln)
+	converged(t, follower, hash)
+	waitFor(t, func() bool { return follower.Leader() == restarted.ID() })
+	assert.Equal(t, restarted.Version(), follower.Version())
+	follower.mu.Lock()
+	assert.Equal(t, 2, follower.snapshots)
+	follower.mu.Unlock()
+}
+
+func TestFollowerOutOfOrder(t *testing.T) {
+	follower := NewFollower("127.0.0.1:0", FollowerOptions{})
+	assert.Nil(t, follower.handle(&Entry{Op: OpSnapshot, Version: 5, Leader: "leader", Data: []byte(`{}`)}))
+	assert.Equal(t, ErrOutOfOrder, follower.handle(&Entry{Op: OpRemove, Version: 7, Group: "db"}))
+	assert.Equal(t, "", follower.Leader())
+	assert.Equal(t, uint64(5), follower.Version())
+
+	follower.leader = "leader"
+	assert.Nil(t, follower.handle(&Entry{Op: OpRemove, Version: 6, Group: "db"}))
+	assert.Equal(t, chash.ErrGroupNotFound, follower.handle(&Entry{Op: OpUpsert, Version: 7, Group: "db"}))
+	assert.Equal(t, "", follower.Leader())
+}
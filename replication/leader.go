@@ -0,0 +1,411 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package replication
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/werbenhu/chash"
+)
+
+// Defaults of a leader, used when the corresponding LeaderOptions field is 0
+const (
+	DefaultMaxLog    = 4096
+	DefaultHeartbeat = 5 * time.Second
+	DefaultTimeout   = 15 * time.Second
+)
+
+// maxHelloSize is the largest hello line a leader reads
+const maxHelloSize = 4096
+
+// ErrLeaderClosed is returned by Serve after Close
+var ErrLeaderClosed = errors.New("replication: leader closed")
+
+// LeaderOptions configures a Leader
+type LeaderOptions struct {
+	// MaxLog is the number of entries kept at least for followers to resume from,
+	// a follower that is further behind is sent a snapshot.
+	MaxLog int
+
+	// Heartbeat is the interval of pings sent to idle followers. It is clamped
+	// to half of Timeout, so pings keep a live connection within its deadlines.
+	Heartbeat time.Duration
+
+	// Timeout limits reading the hello of a follower and writing to it.
+	Timeout time.Duration
+
+	// MaxLineSize is the largest line sent to a follower, 0 meaning DefaultMaxLineSize.
+	// It must not exceed the MaxLineSize of the followers. A follower that would be
+	// sent a larger snapshot or entry is sent ErrTooLarge and disconnected instead.
+	MaxLineSize int
+}
+
+// Leader streams the changes of a CHash to followers.
+//
+// Changes are taken from CHash.Watch and applied to a private copy, so a snapshot
+// taken from the copy always matches the version of the log. Health, leases,
+// sticky assignments and match counters are local to a process and not replicated.
+type Leader struct {
+	hash      *chash.CHash
+	id        string
+	maxLog    int
+	heartbeat time.Duration
+	timeout   time.Duration
+	maxLine   int
+
+	mu        sync.Mutex
+	mirror    *chash.CHash
+	version   uint64
+	base      uint64
+	log       []*Entry
+	err       error
+	changed   chan struct{}
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewLeader starts recording the changes of the CHash. Close stops it.
+func NewLeader(hash *chash.CHash, opts LeaderOptions) *Leader {
+	if opts.MaxLog <= 0 {
+		opts.MaxLog = DefaultMaxLog
+	}
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = DefaultHeartbeat
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Heartbeat >= opts.Timeout {
+		opts.Heartbeat = opts.Timeout / 2
+	}
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = DefaultMaxLineSize
+	}
+	l := &Leader{
+		hash:      hash,
+		id:        newLeaderID(),
+		maxLog:    opts.MaxLog,
+		heartbeat: opts.Heartbeat,
+		timeout:   opts.Timeout,
+		maxLine:   opts.MaxLineSize,
+		mirror:    chash.New(),
+		changed:   make(chan struct{}),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+
+	events := hash.Watch(l.ctx)
+	l.mu.Lock()
+	l.reset()
+	l.mu.Unlock()
+	l.wg.Add(1)
+	go l.follow(events)
+	return l
+}
+
+// ID returns the random ID of the leader, a new one is chosen on every start
+func (l *Leader) ID() string {
+	return l.id
+}
+
+// Version returns the version of the last entry of the log
+func (l *Leader) Version() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.version
+}
+
+// notify wakes up the connections waiting for new entries, the caller must hold l.mu
+func (l *Leader) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Err returns the error that keeps the leader from copying its CHash, nil while
+// followers are served. Followers are sent the error and disconnected until a
+// later change of the CHash can be copied.
+func (l *Leader) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// reset copies the CHash into a new mirror and discards the log, so every
+// follower is sent a snapshot. If the CHash cannot be copied, the previous
+// mirror is kept and the error is recorded. The caller must hold l.mu.
+func (l *Leader) reset() {
+	mirror := chash.New()
+	data, err := l.hash.Serialize()
+	if err == nil {
+		err = apply(mirror, &Entry{Op: OpSnapshot, Data: data})
+	}
+	l.err = err
+	if err != nil {
+		l.notify()
+		return
+	}
+	l.mirror = mirror
+	l.version++
+	l.base = l.version
+	l.log = nil
+	l.notify()
+}
+
+// follow records the events of the CHash until the leader is closed
+func (l *Leader) follow(events <-chan chash.Event) {
+	defer l.wg.Done()
+	for {
+		for e := range events {
+			l.record(e)
+		}
+		if l.ctx.Err() != nil {
+			return
+		}
+		// the watcher fell behind and was dropped, so events were missed
+		events = l.hash.Watch(l.ctx)
+		l.mu.Lock()
+		l.reset()
+		l.mu.Unlock()
+	}
+}
+
+// entryOf turns an event into a log entry. Group events carry the whole group
+// as it is now, later events of the group are applied on top of it.
+func (l *Leader) entryOf(e chash.Event) (*Entry, bool) {
+	entry := &Entry{Group: e.Group, Key: e.Key}
+	switch e.Type {
+	case chash.ElementAdded, chash.PayloadUpdated:
+		entry.Op = OpUpsert
+		entry.Payload = e.Payload
+	case chash.ElementRemoved:
+		entry.Op = OpDelete
+	case chash.GroupRemoved:
+		entry.Op = OpRemove
+	default:
+		group, err := l.hash.GetGroup(e.Group)
+		if err != nil {
+			// removed since, its GroupRemoved event follows
+			return nil, false
+		}
+		data, err := json.Marshal(group)
+		if err != nil {
+			return nil, false
+		}
+		entry.Op = OpReplace
+		entry.Data = data
+	}
+	return entry, true
+}
+
+// record appends the entry of an event to the log
+func (l *Leader) record(e chash.Event) {
+	entry, ok := l.entryOf(e)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		// the new copy includes the change of the entry
+		l.reset()
+		return
+	}
+	if err := apply(l.mirror, entry); err != nil {
+		l.reset()
+		return
+	}
+	l.version++
+	entry.Version = l.version
+	l.log = append(l.log, entry)
+	if len(l.log) >= 2*l.maxLog {
+		dropped := len(l.log) - l.maxLog
+		l.log = append(make([]*Entry, 0, 2*l.maxLog), l.log[dropped:]...)
+		l.base += uint64(dropped)
+	}
+	l.notify()
+}
+
+// ListenAndServe listens on the TCP address and serves followers until Close
+func (l *Leader) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ln)
+}
+
+// Serve accepts followers on the listener until Close, it always returns a non-nil error
+func (l *Leader) Serve(ln net.Listener) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		ln.Close()
+		return ErrLeaderClosed
+	}
+	l.listeners[ln] = struct{}{}
+	l.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.mu.Lock()
+			closed := l.closed
+			delete(l.listeners, ln)
+			l.mu.Unlock()
+			if closed {
+				return ErrLeaderClosed
+			}
+			return err
+		}
+		if !l.track(conn) {
+			continue
+		}
+		go func() {
+			defer l.wg.Done()
+			defer l.untrack(conn)
+			l.serve(conn)
+		}()
+	}
+}
+
+// track registers a new connection to be waited for by Close, or rejects it when the leader is closed
+func (l *Leader) track(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		conn.Close()
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	l.wg.Add(1)
+	return true
+}
+
+// untrack forgets a connection and closes it
+func (l *Leader) untrack(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+	conn.Close()
+}
+
+// Close stops recording, closes all listeners and followers and waits for them to finish
+func (l *Leader) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	for ln := range l.listeners {
+		ln.Close()
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	l.cancel()
+	l.wg.Wait()
+	return nil
+}
+
+// snapshot returns a snapshot entry of the mirror, the caller must hold l.mu
+func (l *Leader) snapshot() (*Entry, error) {
+	data, err := l.mirror.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{Op: OpSnapshot, Version: l.version, Leader: l.id, Data: data}, nil
+}
+
+// serve reads the hello of a follower and streams the log to it
+func (l *Leader) serve(conn net.Conn) {
+	var hello Hello
+	conn.SetReadDeadline(time.Now().Add(l.timeout))
+	if err := json.NewDecoder(io.LimitReader(conn, maxHelloSize)).Decode(&hello); err != nil {
+		return
+	}
+	w := bufio.NewWriter(conn)
+	enc := json.NewEncoder(w)
+	heartbeat := time.NewTicker(l.heartbeat)
+	defer heartbeat.Stop()
+
+	l.mu.Lock()
+	sent := hello.Version
+	if hello.Leader != l.id || sent < l.base || sent > l.version {
+		sent = 0
+	}
+	enc.Encode(&Entry{Op: OpHello, Version: sent, Leader: l.id})
+	l.mu.Unlock()
+
+	for {
+		var pending []*Entry
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return
+		}
+		if l.err != nil {
+			failure := &Entry{Op: OpError, Error: l.err.Error()}
+			l.mu.Unlock()
+			conn.SetWriteDeadline(time.Now().Add(l.timeout))
+			enc.Encode(failure)
+			w.Flush()
+			return
+		}
+		if sent < l.base {
+			snapshot, err := l.snapshot()
+			if err != nil {
+				l.mu.Unlock()
+				return
+			}
+			pending = []*Entry{snapshot}
+		} else {
+			pending = l.log[sent-l.base:]
+		}
+		sent = l.version
+		changed := l.changed
+		l.mu.Unlock()
+
+		for _, entry := range pending {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return
+			}
+			// the deadline is refreshed before every write, as a full buffer writes through
+			conn.SetWriteDeadline(time.Now().Add(l.timeout))
+			if len(line)+1 > l.maxLine {
+				enc.Encode(&Entry{Op: OpError, Error: ErrTooLarge.Error()})
+				w.Flush()
+				return
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(l.timeout))
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			conn.SetWriteDeadline(time.Now().Add(l.timeout))
+			enc.Encode(&Entry{Op: OpPing, Version: sent})
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
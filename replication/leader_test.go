@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package replication
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+// listen serves the leader on a random local port
+func listen(t *testing.T, leader *Leader) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go leader.Serve(ln)
+	return ln.Addr().String()
+}
+
+// connect sends a hello to the leader and returns a reader of its entries
+func connect(t *testing.T, addr string, hello Hello) (net.Conn, func() *Entry) {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	assert.Nil(t, json.NewEncoder(conn).Encode(&hello))
+	scanner := bufio.NewScanner(conn)
+	return conn, func() *Entry {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if !scanner.Scan() {
+			return nil
+		}
+		var entry Entry
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &entry))
+		return &entry
+	}
+}
+
+// waitFor polls cond until it holds or fails the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+// waitVersion waits until the leader has recorded the given version
+func waitVersion(t *testing.T, leader *Leader, version uint64) {
+	waitFor(t, func() bool {
+		return leader.Version() >= version
+	})
+}
+
+func TestLeaderLog(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 10)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	leader := NewLeader(hash, LeaderOptions{})
+	defer leader.Close()
+	assert.Equal(t, uint64(1), leader.Version())
+	addr := listen(t, leader)
+
+	conn, next := connect(t, addr, Hello{})
+	defer conn.Close()
+	assert.Equal(t, &Entry{Op: OpHello, Leader: leader.ID()}, next())
+	snapshot := next()
+	assert.Equal(t, OpSnapshot, snapshot.Op)
+	assert.Equal(t, uint64(1), snapshot.Version)
+	assert.Equal(t, leader.ID(), snapshot.Leader)
+	expected, _ := hash.Serialize()
+	assert.JSONEq(t, string(expected), string(snapshot.Data))
+
+	db.Upsert("192.168.1.101:3306", []byte("mysql1"))
+	db.Delete("192.168.1.100:3306")
+	hash.CreateGroup("redis", 20)
+	hash.RemoveGroup("db")
+	assert.Equal(t, &Entry{Op: OpUpsert, Version: 2, Group: "db", Key: "192.168.1.101:3306", Payload: []byte("mysql1")}, next())
+	assert.Equal(t, &Entry{Op: OpDelete, Version: 3, Group: "db", Key: "192.168.1.100:3306"}, next())
+	replace := next()
+	assert.Equal(t, OpReplace, replace.Op)
+	assert.Equal(t, uint64(4), replace.Version)
+	assert.JSONEq(t, `{"name":"redis","numberOfReplicas":20,"elements":{}}`, string(replace.Data))
+	assert.Equal(t, &Entry{Op: OpRemove, Version: 5, Group: "db"}, next())
+
+	resumed, next := connect(t, addr, Hello{Leader: leader.ID(), Version: 3})
+	defer resumed.Close()
+	assert.Equal(t, &Entry{Op: OpHello, Version: 3, Leader: leader.ID()}, next())
+	assert.Equal(t, uint64(4), next().Version)
+	assert.Equal(t, uint64(5), next().Version)
+
+	stale, next := connect(t, addr, Hello{Leader: "restarted", Version: 3})
+	defer stale.Close()
+	assert.Equal(t, uint64(0), next().Version)
+	assert.Equal(t, OpSnapshot, next().Op)
+}
+
+func TestLeaderCompaction(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 1)
+	leader := NewLeader(hash, LeaderOptions{MaxLog: 2, Heartbeat: 10 * time.Millisecond})
+	defer leader.Close()
+	addr := listen(t, leader)
+	for i := 0; i < 5; i++ {
+		db.Upsert("192.168.1.100:3306", nil)
+	}
+	waitVersion(t, leader, 6)
+
+	conn, next := connect(t, addr, Hello{Leader: leader.ID(), Version: 1})
+	defer conn.Close()
+	assert.Equal(t, uint64(0), next().Version)
+	snapshot := next()
+	assert.Equal(t, OpSnapshot, snapshot.Op)
+	assert.Equal(t, uint64(6), snapshot.Version)
+	assert.Equal(t, &Entry{Op: OpPing, Version: 6}, next())
+
+	resumed, next := connect(t, addr, Hello{Leader: leader.ID(), Version: 5})
+	defer resumed.Close()
+	assert.Equal(t, uint64(5), next().Version)
+	assert.Equal(t, &Entry{Op: OpUpsert, Version: 6, Group: "db", Key: "192.168.1.100:3306"}, next())
+}
+
+func TestLeaderTooLarge(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 10)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	leader := NewLeader(hash, LeaderOptions{MaxLineSize: 128})
+	defer leader.Close()
+	addr := listen(t, leader)
+
+	conn, next := connect(t, addr, Hello{})
+	defer conn.Close()
+	assert.Equal(t, OpHello, next().Op)
+	assert.Equal(t, &Entry{Op: OpError, Error: ErrTooLarge.Error()}, next())
+	assert.Nil(t, next())
+
+	follower := NewFollower(addr, FollowerOptions{MinBackoff: time.Millisecond})
+	follower.Start()
+	defer follower.Stop()
+	waitFor(t, func() bool { return follower.Err() == ErrTooLarge })
+	assert.Equal(t, "", follower.Leader())
+}
+
+func TestLeaderCopyError(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 10)
+	db.Insert("192.168.1.100:3306", nil)
+	bad, _ := hash.CreateGroup("bad", 10)
+	bad.Lock()
+	bad.NumberOfReplicas = 0
+	bad.Unlock()
+
+	leader := NewLeader(hash, LeaderOptions{})
+	defer leader.Close()
+	assert.Equal(t, chash.ErrInvalidReplicas, leader.Err())
+	addr := listen(t, leader)
+
+	conn, next := connect(t, addr, Hello{})
+	defer conn.Close()
+	assert.Equal(t, OpHello, next().Op)
+	assert.Equal(t, &Entry{Op: OpError, Error: chash.ErrInvalidReplicas.Error()}, next())
+	assert.Nil(t, next())
+
+	follower := NewFollower(addr, FollowerOptions{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	follower.Start()
+	defer follower.Stop()
+	waitFor(t, func() bool {
+		return follower.Err() != nil && follower.Err().Error() == chash.ErrInvalidReplicas.Error()
+	})
+	_, _, err := follower.Match("db", "user-id-1")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+
+	// the next change that can be copied recovers the leader
+	hash.RemoveGroup("bad")
+	waitFor(t, func() bool { return leader.Err() == nil })
+	converged(t, follower, hash)
+	waitFor(t, follower.Connected)
+	assert.Nil(t, follower.Err())
+}
+
+func TestLeaderIdle(t *testing.T) {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 10)
+	leader := NewLeader(hash, LeaderOptions{Heartbeat: time.Second, Timeout: 100 * time.Millisecond})
+	defer leader.Close()
+	assert.Equal(t, 50*time.Millisecond, leader.heartbeat)
+	addr := listen(t, leader)
+
+	conn, next := connect(t, addr, Hello{})
+	defer conn.Close()
+	assert.Equal(t, OpHello, next().Op)
+	assert.Equal(t, OpSnapshot, next().Op)
+
+	// an entry larger than the write buffer is written after the last deadline passed
+	time.Sleep(300 * time.Millisecond)
+	db.Insert("192.168.1.100:3306", make([]byte, 10<<10))
+	entry := next()
+	for entry != nil && entry.Op == OpPing {
+		entry = next()
+	}
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, OpUpsert, entry.Op)
+		assert.Equal(t, uint64(2), entry.Version)
+	}
+}
+
+func TestLeaderClose(t *testing.T) {
+	leader := NewLeader(chash.New(), LeaderOptions{})
+	addr := listen(t, leader)
+	conn, next := connect(t, addr, Hello{})
+	defer conn.Close()
+	assert.Equal(t, OpHello, next().Op)
+
+	assert.Nil(t, leader.Close())
+	assert.Equal(t, OpSnapshot, next().Op)
+	assert.Nil(t, next())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrLeaderClosed, leader.Serve(ln))
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+// Package replication keeps the groups of follower processes in sync with a
+// leader CHash over TCP. The leader records every change of its CHash in a
+// versioned log and streams it to followers as JSON lines:
+//
+//	follower -> leader  {"leader":"<id>","version":<n>}      resume after version n
+//	leader -> follower  {"op":"hello","leader":"<id>","version":<n>}
+//	leader -> follower  {"op":"snapshot","version":<n>,"data":<CHash snapshot>}
+//	leader -> follower  {"op":"upsert","version":<n>,"group":"db","key":"...","payload":"..."}
+//	leader -> follower  {"op":"ping","version":<n>}
+//	leader -> follower  {"op":"error","error":"..."}           before closing the connection
+//
+// A follower that reconnects to the same leader resumes from its last version
+// if the leader still holds the log from there, otherwise it is bootstrapped
+// with a snapshot first. Followers are read-only, their writes return ErrReadOnly.
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/werbenhu/chash"
+)
+
+// Operations of the log entries sent by a leader
+const (
+	OpHello    = "hello"
+	OpSnapshot = "snapshot"
+	OpUpsert   = "upsert"
+	OpDelete   = "delete"
+	OpReplace  = "replace"
+	OpRemove   = "remove"
+	OpPing     = "ping"
+	OpError    = "error"
+)
+
+// DefaultMaxLineSize is the largest JSON line, including its newline, a leader
+// sends and a follower reads, used when the MaxLineSize option is 0
+const DefaultMaxLineSize = 64 << 20
+
+// ErrReadOnly is returned by the write methods of a Follower
+var ErrReadOnly = errors.New("replication: follower is read-only")
+
+// ErrOutOfOrder is returned when a follower receives an entry that does not follow its version
+var ErrOutOfOrder = errors.New("replication: entry out of order")
+
+// ErrUnknownOp is returned for an entry with an unknown operation
+var ErrUnknownOp = errors.New("replication: unknown operation")
+
+// ErrTooLarge is sent by a leader instead of an entry, typically a snapshot,
+// that does not fit in a line, and returned by Follower.Err
+var ErrTooLarge = errors.New("replication: entry exceeds the line size limit")
+
+// Hello is the first line a follower sends. Leader and Version are those of the
+// last entry the follower applied, empty and 0 for a new follower.
+type Hello struct {
+	Leader  string `json:"leader"`
+	Version uint64 `json:"version"`
+}
+
+// Entry is a line sent by the leader.
+//
+// OpUpsert and OpDelete change a single element, OpReplace replaces a whole
+// group with Data, which is the JSON of the group, and OpRemove removes a group.
+// OpSnapshot replaces all groups with Data, a CHash.Serialize snapshot.
+// OpHello and OpPing do not change anything and carry the current version.
+// OpError carries the reason the leader closes the connection in Error.
+type Entry struct {
+	Op      string          `json:"op"`
+	Version uint64          `json:"version"`
+	Leader  string          `json:"leader,omitempty"`
+	Group   string          `json:"group,omitempty"`
+	Key     string          `json:"key,omitempty"`
+	Payload []byte          `json:"payload,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// unlimited accepts any snapshot sent by the leader, which already holds it
+var unlimited = chash.RestoreOptions{MaxGroups: -1, MaxElements: -1, MaxReplicas: -1, MaxPoints: -1}
+
+// errorOf returns the error sent in an OpError entry
+func errorOf(e *Entry) error {
+	if e.Error == ErrTooLarge.Error() {
+		return ErrTooLarge
+	}
+	return errors.New(e.Error)
+}
+
+// newLeaderID returns a random leader ID, so followers notice a restarted leader
+func newLeaderID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// apply performs a changing entry on a CHash
+func apply(hash *chash.CHash, e *Entry) error {
+	switch e.Op {
+	case OpSnapshot:
+		opts := unlimited
+		opts.Mode = chash.RestoreReplace
+		return hash.RestoreWithOptions(e.Data, opts)
+	case OpUpsert:
+		group, err := hash.GetGroup(e.Group)
+		if err != nil {
+			return err
+		}
+		return group.Upsert(e.Key, e.Payload)
+	case OpDelete:
+		group, err := hash.GetGroup(e.Group)
+		if err != nil {
+			return err
+		}
+		return group.Delete(e.Key)
+	case OpReplace:
+		data, err := json.Marshal(map[string]json.RawMessage{e.Group: e.Data})
+		if err != nil {
+			return err
+		}
+		opts := unlimited
+		opts.Mode = chash.RestoreMerge
+		return hash.RestoreWithOptions(data, opts)
+	case OpRemove:
+		hash.RemoveGroup(e.Group)
+		return nil
+	}
+	return ErrUnknownOp
+}
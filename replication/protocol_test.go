@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package replication
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+func TestApply(t *testing.T) {
+	hash := chash.New()
+	source := chash.New()
+	db, _ := source.CreateGroup("db", 10)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	snapshot, _ := source.Serialize()
+
+	assert.Nil(t, apply(hash, &Entry{Op: OpSnapshot, Data: snapshot}))
+	assert.Nil(t, apply(hash, &Entry{Op: OpUpsert, Group: "db", Key: "192.168.1.101:3306", Payload: []byte("mysql1")}))
+	assert.Nil(t, apply(hash, &Entry{Op: OpDelete, Group: "db", Key: "192.168.1.100:3306"}))
+	element, payload, err := hash.Match("db", "user-id-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.1.101:3306", element)
+	assert.Equal(t, []byte("mysql1"), payload)
+
+	redis := chash.NewGroup("redis", 20)
+	redis.Insert("192.168.1.100:6379", nil)
+	data, _ := json.Marshal(redis)
+	assert.Nil(t, apply(hash, &Entry{Op: OpReplace, Group: "redis", Data: data}))
+	group, err := hash.GetGroup("redis")
+	assert.Nil(t, err)
+	assert.Equal(t, 20, group.NumberOfReplicas)
+	assert.Equal(t, 1, len(group.GetElements()))
+
+	assert.Nil(t, apply(hash, &Entry{Op: OpRemove, Group: "db"}))
+	_, err = hash.GetGroup("db")
+	assert.Equal(t, chash.ErrGroupNotFound, err)
+
+	assert.Equal(t, chash.ErrGroupNotFound, apply(hash, &Entry{Op: OpUpsert, Group: "db", Key: "192.168.1.100:3306"}))
+	assert.Equal(t, ErrUnknownOp, apply(hash, &Entry{Op: "truncate"}))
+	assert.NotEqual(t, newLeaderID(), newLeaderID())
+}
+
+func TestErrorOf(t *testing.T) {
+	assert.Equal(t, ErrTooLarge, errorOf(&Entry{Op: OpError, Error: ErrTooLarge.Error()}))
+	assert.EqualError(t, errorOf(&Entry{Op: OpError, Error: "boom"}), "boom")
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// readBufferSize is the read buffer of a connection and so the longest line
+// accepted for inline commands and headers
+const readBufferSize = 16 << 10
+
+// protocolError is a malformed or oversized request, the connection is closed after replying
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// reader reads commands sent as RESP arrays of bulk strings, or as inline
+// commands separated by spaces as typed into telnet
+type reader struct {
+	*bufio.Reader
+	maxArgs     int
+	maxBulkSize int
+}
+
+// line reads a line without its CRLF
+func (r *reader) line() (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", protocolError("Protocol error: too big line")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// length parses the length following a '*' or '$' prefix
+func (r *reader) length(line string, prefix byte, max int) (int, error) {
+	if len(line) == 0 || line[0] != prefix {
+		return 0, protocolError("Protocol error: expected '" + string(prefix) + "'")
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return 0, protocolError("Protocol error: invalid length")
+	}
+	if n > max {
+		return 0, protocolError("Protocol error: length exceeds limit")
+	}
+	return n, nil
+}
+
+// command reads the next command, it returns an empty command for blank lines
+func (r *reader) command() ([]string, error) {
+	line, err := r.line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		args := strings.Fields(line)
+		if len(args) > r.maxArgs {
+			return nil, protocolError("Protocol error: too many arguments")
+		}
+		return args, nil
+	}
+
+	n, err := r.length(line, '*', r.maxArgs)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := r.line()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.length(header, '$', r.maxBulkSize)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, protocolError("Protocol error: expected CRLF")
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// writer writes RESP replies
+type writer struct {
+	*bufio.Writer
+}
+
+// simple writes a simple string reply
+func (w writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+// error writes an error reply, the message should start with an error code such as ERR
+func (w writer) error(msg string) {
+	w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
+
+// integer writes an integer reply
+func (w writer) integer(n int) {
+	w.WriteString(":" + strconv.Itoa(n) + "\r\n")
+}
+
+// bulk writes a bulk string reply
+func (w writer) bulk(b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+// null writes a null bulk string reply
+func (w writer) null() {
+	w.WriteString("$-1\r\n")
+}
+
+// array writes the header of an array reply of n elements
+func (w writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// isProtocolError tells whether err was caused by a malformed request
+func isProtocolError(err error) bool {
+	var perr protocolError
+	return errors.As(err, &perr)
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newReader(s string) *reader {
+	return &reader{Reader: bufio.NewReader(strings.NewReader(s)), maxArgs: 4, maxBulkSize: 16}
+}
+
+func TestReaderCommand(t *testing.T) {
+	r := newReader("*3\r\n$11\r\nCHASH.MATCH\r\n$2\r\ndb\r\n$0\r\n\r\nPING  hello\r\n\r\n")
+	args, err := r.command()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"CHASH.MATCH", "db", ""}, args)
+
+	args, err = r.command()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PING", "hello"}, args)
+
+	args, err = r.command()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(args))
+
+	_, err = r.command()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReaderLimits(t *testing.T) {
+	for _, in := range []string{
+		"*5\r\n",
+		"*1\r\n$17\r\n",
+		"*1\r\n$-1\r\n",
+		"*1\r\n+OK\r\n",
+		"*1\r\n$2\r\nabcd",
+		"a b c d e\r\n",
+	} {
+		_, err := newReader(in).command()
+		assert.True(t, isProtocolError(err), in)
+	}
+
+	_, err := newReader("*1\r\n$4\r\nab").command()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := writer{bufio.NewWriter(&buf)}
+	w.array(4)
+	w.simple("OK")
+	w.integer(2)
+	w.bulk([]byte("a\r\nb"))
+	w.null()
+	w.error("ERR bad\r\nline")
+	w.Flush()
+	assert.Equal(t, "*4\r\n+OK\r\n:2\r\n$4\r\na\r\nb\r\n$-1\r\n-ERR bad  line\r\n", buf.String())
+}
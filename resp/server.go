@@ -0,0 +1,366 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+// Package resp serves ring lookups of a CHash over the Redis protocol (RESP),
+// so redis-cli and any Redis client library can query placement:
+//
+//	CHASH.MATCH group key            the element of key as [element, payload]
+//	CHASH.MATCHN group key n         up to n distinct elements of key as [[element, payload], ...]
+//	CHASH.ADD group element [payload] insert or update an element, 1 if it was added
+//	CHASH.DEL group element [...]    delete elements, the number deleted
+//	CHASH.MEMBERS group              the elements of a group, sorted
+//	CHASH.GROUPS                     the groups, sorted
+//	CHASH.FINGERPRINT [group]        the fingerprint of a group, or of all groups
+//
+// PING, QUIT and COMMAND are supported as well. Commands may be pipelined.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/werbenhu/chash"
+)
+
+// Default limits of a server, used when the corresponding Options field is 0.
+const (
+	DefaultMaxConnections = 1024
+	DefaultMaxArgs        = 1024
+	DefaultMaxBulkSize    = 1 << 20
+	DefaultIdleTimeout    = 5 * time.Minute
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Options are the limits of a server. A zero value means the default,
+// a negative MaxConnections or IdleTimeout means no limit.
+type Options struct {
+	// MaxConnections is the number of connections served at the same time,
+	// further connections are answered with an error and closed.
+	MaxConnections int
+
+	// MaxArgs is the largest number of arguments of a single command.
+	MaxArgs int
+
+	// MaxBulkSize is the largest argument in bytes.
+	MaxBulkSize int
+
+	// IdleTimeout closes a connection that sends no command for that long.
+	IdleTimeout time.Duration
+}
+
+// Server serves a CHash over RESP
+type Server struct {
+	hash *chash.CHash
+	opts Options
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer creates a server for the given CHash
+func NewServer(hash *chash.CHash, opts Options) *Server {
+	if opts.MaxConnections == 0 {
+		opts.MaxConnections = DefaultMaxConnections
+	}
+	if opts.MaxArgs <= 0 {
+		opts.MaxArgs = DefaultMaxArgs
+	}
+	if opts.MaxBulkSize <= 0 {
+		opts.MaxBulkSize = DefaultMaxBulkSize
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	return &Server{
+		hash:      hash,
+		opts:      opts,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address and serves connections until Close
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on the listener until Close, it always returns a non-nil error
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn) {
+			continue
+		}
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.serve(conn)
+		}()
+	}
+}
+
+// track registers a new connection to be waited for by Close, or rejects it when the server is full or closed
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return false
+	}
+	if s.opts.MaxConnections > 0 && len(s.conns) >= s.opts.MaxConnections {
+		conn.Write([]byte("-ERR max number of clients reached\r\n"))
+		conn.Close()
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+// untrack forgets a connection and closes it, so its slot is free once the peer sees it closed
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// Close stops all listeners, closes all connections and waits for them to finish
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// serve reads and answers the commands of a connection. Replies are buffered
+// and flushed once no pipelined command is left to read.
+func (s *Server) serve(conn net.Conn) {
+	r := &reader{
+		Reader:      bufio.NewReaderSize(conn, readBufferSize),
+		maxArgs:     s.opts.MaxArgs,
+		maxBulkSize: s.opts.MaxBulkSize,
+	}
+	w := writer{bufio.NewWriter(conn)}
+	for {
+		if s.opts.IdleTimeout > 0 && r.Buffered() == 0 {
+			conn.SetReadDeadline(time.Now().Add(s.opts.IdleTimeout))
+		}
+		args, err := r.command()
+		if err != nil {
+			if isProtocolError(err) {
+				w.error("ERR " + err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if quit := s.exec(w, args); quit {
+			w.Flush()
+			return
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// arity checks the number of arguments of a command
+func arity(w writer, args []string, min int, max int) bool {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		w.error("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+		return false
+	}
+	return true
+}
+
+// group looks up the group named by the first argument of a command
+func (s *Server) group(w writer, name string) *chash.Group {
+	group, err := s.hash.GetGroup(name)
+	if err != nil {
+		w.error("ERR " + err.Error())
+		return nil
+	}
+	return group
+}
+
+// element writes an element as [key, payload]
+func element(w writer, key string, payload []byte) {
+	w.array(2)
+	w.bulk([]byte(key))
+	w.bulk(payload)
+}
+
+// exec runs a single command and reports whether the connection should be closed
+func (s *Server) exec(w writer, args []string) bool {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		if arity(w, args, 1, 2) {
+			if len(args) == 2 {
+				w.bulk([]byte(args[1]))
+			} else {
+				w.simple("PONG")
+			}
+		}
+
+	case "QUIT":
+		w.simple("OK")
+		return true
+
+	case "COMMAND":
+		// redis-cli asks for the command table on startup, an empty one is enough
+		w.array(0)
+
+	case "CHASH.GROUPS":
+		if arity(w, args, 1, 1) {
+			groups := s.hash.GetGroups()
+			w.array(len(groups))
+			for _, group := range groups {
+				w.bulk([]byte(group.Name))
+			}
+		}
+
+	case "CHASH.FINGERPRINT":
+		if !arity(w, args, 1, 2) {
+			break
+		}
+		if len(args) == 1 {
+			w.bulk([]byte(s.hash.Fingerprint()))
+		} else if group := s.group(w, args[1]); group != nil {
+			w.bulk([]byte(group.Fingerprint()))
+		}
+
+	case "CHASH.MEMBERS":
+		if !arity(w, args, 2, 2) {
+			break
+		}
+		if group := s.group(w, args[1]); group != nil {
+			elements := group.GetElements()
+			keys := make([]string, 0, len(elements))
+			for _, e := range elements {
+				keys = append(keys, e.Key)
+			}
+			sort.Strings(keys)
+			w.array(len(keys))
+			for _, key := range keys {
+				w.bulk([]byte(key))
+			}
+		}
+
+	case "CHASH.MATCH":
+		if !arity(w, args, 3, 3) {
+			break
+		}
+		if group := s.group(w, args[1]); group != nil {
+			key, payload, err := group.Match(args[2])
+			if err == chash.ErrNoResultMatched {
+				w.null()
+			} else if err != nil {
+				w.error("ERR " + err.Error())
+			} else {
+				element(w, key, payload)
+			}
+		}
+
+	case "CHASH.MATCHN":
+		if !arity(w, args, 4, 4) {
+			break
+		}
+		n, err := strconv.Atoi(args[3])
+		if err != nil || n < 0 {
+			w.error("ERR value is not an integer or out of range")
+			break
+		}
+		if group := s.group(w, args[1]); group != nil {
+			elements, err := group.MatchN(args[2], n)
+			if err != nil && err != chash.ErrNoResultMatched {
+				w.error("ERR " + err.Error())
+				break
+			}
+			w.array(len(elements))
+			for _, e := range elements {
+				element(w, e.Key, e.Payload)
+			}
+		}
+
+	case "CHASH.ADD":
+		if !arity(w, args, 3, 4) {
+			break
+		}
+		if group := s.group(w, args[1]); group != nil {
+			var payload []byte
+			if len(args) == 4 {
+				payload = []byte(args[3])
+			}
+			if added, err := group.Add(args[2], payload); err != nil {
+				w.error("ERR " + err.Error())
+			} else if added {
+				w.integer(1)
+			} else {
+				w.integer(0)
+			}
+		}
+
+	case "CHASH.DEL":
+		if !arity(w, args, 3, -1) {
+			break
+		}
+		if group := s.group(w, args[1]); group != nil {
+			if deleted, err := group.Remove(args[2:]...); err != nil {
+				w.error("ERR " + err.Error())
+			} else {
+				w.integer(deleted)
+			}
+		}
+
+	default:
+		w.error("ERR unknown command '" + args[0] + "'")
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package resp
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+// start serves the CHash on a random local port
+func start(t *testing.T, hash *chash.CHash, opts Options) (*Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	srv := NewServer(hash, opts)
+	go srv.Serve(l)
+	return srv, l.Addr().String()
+}
+
+// roundTrip writes raw bytes on a new connection and reads the expected number of reply bytes
+func roundTrip(t *testing.T, addr string, request string, size int) string {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte(request))
+	assert.Nil(t, err)
+	reply := make([]byte, size)
+	n, _ := readFull(conn, reply)
+	return string(reply[:n])
+}
+
+// readFull reads until buf is full or the connection fails
+func readFull(conn net.Conn, buf []byte) (int, error) {
+	read := 0
+	for read < len(buf) {
+		n, err := conn.Read(buf[read:])
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func newHash() *chash.CHash {
+	hash := chash.New()
+	db, _ := hash.CreateGroup("db", 100)
+	db.Insert("192.168.1.100:3306", []byte("mysql0"))
+	db.Insert("192.168.1.101:3306", []byte("mysql1"))
+	hash.CreateGroup("redis", 100)
+	return hash
+}
+
+func TestServerCommands(t *testing.T) {
+	hash := newHash()
+	srv, addr := start(t, hash, Options{})
+	defer srv.Close()
+
+	db, _ := hash.GetGroup("db")
+	key, payload, _ := db.Match("user-id-1")
+	want := "*2\r\n$18\r\n" + key + "\r\n$6\r\n" + string(payload) + "\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "*3\r\n$11\r\nCHASH.MATCH\r\n$2\r\ndb\r\n$9\r\nuser-id-1\r\n", len(want)))
+	assert.Equal(t, want, roundTrip(t, addr, "chash.match db user-id-1\r\n", len(want)))
+
+	want = "*2\r\n*2\r\n$18\r\n" + key + "\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.MATCHN db user-id-1 5\r\n", len(want)))
+
+	want = "$-1\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.MATCH redis user-id-1\r\n", len(want)))
+	want = "*0\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.MATCHN redis user-id-1 2\r\n", len(want)))
+	want = "-ERR group not found\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.MATCH mongo user-id-1\r\n", len(want)))
+	want = "-ERR wrong number of arguments for 'chash.match' command\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.MATCH db\r\n", len(want)))
+	want = "-ERR value is not an integer or out of range\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.MATCHN db user-id-1 x\r\n", len(want)))
+	want = "-ERR unknown command 'FLUSHALL'\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "FLUSHALL\r\n", len(want)))
+
+	want = "*2\r\n$2\r\ndb\r\n$5\r\nredis\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.GROUPS\r\n", len(want)))
+	want = "*2\r\n$18\r\n192.168.1.100:3306\r\n$18\r\n192.168.1.101:3306\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.MEMBERS db\r\n", len(want)))
+
+	db, _ = hash.GetGroup("db")
+	want = "$32\r\n" + db.Fingerprint() + "\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.FINGERPRINT db\r\n", len(want)))
+	want = "$32\r\n" + hash.Fingerprint() + "\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "CHASH.FINGERPRINT\r\n", len(want)))
+}
+
+func TestServerPipeline(t *testing.T) {
+	hash := newHash()
+	srv, addr := start(t, hash, Options{})
+	defer srv.Close()
+
+	request := strings.Join([]string{
+		"PING",
+		"CHASH.ADD redis 192.168.1.100:6379 redis0",
+		"CHASH.ADD redis 192.168.1.100:6379 redis0-info",
+		"CHASH.ADD redis 192.168.1.101:6379",
+		"CHASH.DEL redis 192.168.1.101:6379 192.168.1.102:6379 192.168.1.101:6379",
+		"CHASH.MEMBERS redis",
+		"QUIT",
+		"PING",
+	}, "\r\n") + "\r\n"
+	want := "+PONG\r\n:1\r\n:0\r\n:1\r\n:1\r\n*1\r\n$18\r\n192.168.1.100:6379\r\n+OK\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, request, len(want)+10))
+
+	redis, _ := hash.GetGroup("redis")
+	assert.Equal(t, []byte("redis0-info"), redis.Elements["192.168.1.100:6379"].Payload)
+}
+
+func TestServerLimits(t *testing.T) {
+	srv, addr := start(t, newHash(), Options{MaxConnections: 1, MaxArgs: 3, MaxBulkSize: 8, IdleTimeout: 100 * time.Millisecond})
+	defer srv.Close()
+
+	want := "-ERR Protocol error: too many arguments\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "PING a b c\r\nPING\r\n", len(want)+10))
+	want = "-ERR Protocol error: length exceeds limit\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "*2\r\n$4\r\nPING\r\n$9\r\n", len(want)+10))
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("PING\r\n"))
+	line, _ := r.ReadString('\n')
+	assert.Equal(t, "+PONG\r\n", line)
+
+	want = "-ERR max number of clients reached\r\n"
+	assert.Equal(t, want, roundTrip(t, addr, "PING\r\n", len(want)))
+
+	// the idle connection is closed by the server
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	rest, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rest))
+}
+
+func TestServerClose(t *testing.T) {
+	srv, addr := start(t, newHash(), Options{})
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write([]byte("PING\r\n"))
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	assert.Equal(t, "+PONG\r\n", line)
+
+	assert.Nil(t, srv.Close())
+	_, err = net.Dial("tcp", addr)
+	assert.NotNil(t, err)
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, ErrServerClosed, srv.Serve(l))
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RestoreMode controls how a snapshot is combined with the existing groups.
+type RestoreMode int
+
+const (
+	// RestoreReplace replaces all existing groups with the groups of the snapshot.
+	RestoreReplace RestoreMode = iota
+
+	// RestoreMerge keeps the existing groups and adds the groups of the snapshot.
+	// A group that exists in both is replaced by the one from the snapshot.
+	RestoreMerge
+)
+
+// Default limits used by Restore when a RestoreOptions limit is zero.
+const (
+	DefaultMaxGroups   = 1024
+	DefaultMaxElements = 10000
+	DefaultMaxReplicas = 100000
+	DefaultMaxPoints   = 1000000
+)
+
+// RestoreOptions configures how a snapshot is validated and applied.
+// A zero limit falls back to its default, a negative limit disables the check.
+type RestoreOptions struct {
+	Mode RestoreMode
+
+	// MaxGroups limits the number of groups in the registry after the restore.
+	MaxGroups int
+
+	// MaxElements limits the number of elements of each group.
+	MaxElements int
+
+	// MaxReplicas limits the number of replicas of each group.
+	MaxReplicas int
+
+	// MaxPoints limits the number of virtual nodes of each group,
+	// which is its number of elements times its number of replicas.
+	MaxPoints int
+}
+
+// restoreStats records the duration and outcome of restores for metrics
+type restoreStats struct {
+	sync.Mutex
+	count   uint64
+	errors  uint64
+	seconds float64
+}
+
+// observe records a single restore
+func (s *restoreStats) observe(d time.Duration, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.count++
+	s.seconds += d.Seconds()
+}
+
+// limit returns the effective value of a limit, -1 meaning unlimited
+func limit(value int, def int) int {
+	if value == 0 {
+		return def
+	}
+	if value < 0 {
+		return -1
+	}
+	return value
+}
+
+// exceeds reports whether n is over the given effective limit
+func exceeds(n int, max int) bool {
+	return max >= 0 && n > max
+}
+
+// exceedsPoints reports whether a group of the given size has more virtual nodes
+// than the effective limit, without overflowing on large replicas
+func exceedsPoints(elements int, replicas int, max int) bool {
+	return max >= 0 && elements > 0 && replicas > max/elements
+}
+
+// validate checks the decoded groups against the options
+func (o RestoreOptions) validate(groups map[string]*Group) error {
+	if groups == nil {
+		return ErrInvalidSnapshot
+	}
+	if exceeds(len(groups), limit(o.MaxGroups, DefaultMaxGroups)) {
+		return ErrTooManyGroups
+	}
+
+	maxElements := limit(o.MaxElements, DefaultMaxElements)
+	maxReplicas := limit(o.MaxReplicas, DefaultMaxReplicas)
+	maxPoints := limit(o.MaxPoints, DefaultMaxPoints)
+	for name, group := range groups {
+		if group == nil || group.Name != name {
+			return ErrInvalidSnapshot
+		}
+		if group.NumberOfReplicas <= 0 || exceeds(group.NumberOfReplicas, maxReplicas) {
+			return ErrInvalidReplicas
+		}
+		if exceeds(len(group.Elements), maxElements) {
+			return ErrTooManyElements
+		}
+		if exceedsPoints(len(group.Elements), group.NumberOfReplicas, maxPoints) {
+			return ErrTooManyPoints
+		}
+		for key, element := range group.Elements {
+			if element == nil || element.Key != key {
+				return ErrInvalidSnapshot
+			}
+		}
+	}
+	return nil
+}
+
+// sortedNames returns the names of the groups in ascending order
+func sortedNames(groups map[string]*Group) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// prepareSnapshot validates decoded groups and builds their circles
+func prepareSnapshot(groups map[string]*Group, opts RestoreOptions) error {
+	if err := opts.validate(groups); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		group.Init()
+		group.rehash()
+	}
+	return nil
+}
+
+// RestoreWithOptions deserializes a JSON representation of the CHash structure.
+// The snapshot is decoded and validated into new groups before anything is changed,
+// so a snapshot that fails to restore leaves the registry untouched.
+//
+// Existing groups whose names appear in the snapshot are updated in place,
+// so *Group handles obtained earlier stay valid. Groups dropped from the registry
+// by a RestoreReplace are marked as removed and their methods return ErrGroupRemoved.
+func (c *CHash) RestoreWithOptions(data []byte, opts RestoreOptions) (err error) {
+	start := time.Now()
+	defer func() {
+		c.restores.observe(time.Since(start), err)
+	}()
+
+	var groups map[string]*Group
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return err
+	}
+	return c.restoreGroups(groups, opts)
+}
+
+// restoreGroups validates decoded groups and installs them into the registry
+func (c *CHash) restoreGroups(groups map[string]*Group, opts RestoreOptions) error {
+	if err := prepareSnapshot(groups, opts); err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if opts.Mode == RestoreMerge {
+		total := len(c.groups)
+		for name := range groups {
+			if _, ok := c.groups[name]; !ok {
+				total++
+			}
+		}
+		if exceeds(total, limit(opts.MaxGroups, DefaultMaxGroups)) {
+			return ErrTooManyGroups
+		}
+	} else {
+		for _, name := range sortedNames(c.groups) {
+			if _, ok := groups[name]; !ok {
+				c.groups[name].markRemoved()
+				delete(c.groups, name)
+			}
+		}
+	}
+
+	for _, name := range sortedNames(groups) {
+		if existing, ok := c.groups[name]; ok {
+			existing.replaceWith(groups[name])
+			continue
+		}
+		c.adopt(groups[name])
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreInvalidKeepsGroups(t *testing.T) {
+	hash := New()
+	hash.CreateGroup("werbenhu1", 100)
+	hash.Insert("werbenhu1", "192.168.1.101:8080", []byte("werbenhu101"))
+
+	items := []struct {
+		data string
+		err  error
+	}{
+		{data: `null`, err: ErrInvalidSnapshot},
+		{data: `{"werbenhu2":null}`, err: ErrInvalidSnapshot},
+		{data: `{"werbenhu2":{"name":"other","numberOfReplicas":10}}`, err: ErrInvalidSnapshot},
+		{data: `{"werbenhu2":{"name":"werbenhu2","numberOfReplicas":0}}`, err: ErrInvalidReplicas},
+		{data: `{"werbenhu2":{"name":"werbenhu2","numberOfReplicas":1000000000}}`, err: ErrInvalidReplicas},
+		{data: `{"werbenhu2":{"name":"werbenhu2","numberOfReplicas":100000,"elements":{"a":{"key":"a"},"b":{"key":"b"},"c":{"key":"c"},"d":{"key":"d"},"e":{"key":"e"},"f":{"key":"f"},"g":{"key":"g"},"h":{"key":"h"},"i":{"key":"i"},"j":{"key":"j"},"k":{"key":"k"}}}}`, err: ErrTooManyPoints},
+		{data: `{"werbenhu2":{"name":"werbenhu2","numberOfReplicas":10,"elements":{"a":{"key":"b"}}}}`, err: ErrInvalidSnapshot},
+		{data: `{"werbenhu2":{"name":"werbenhu2","numberOfReplicas":10,"elements":{"a":null}}}`, err: ErrInvalidSnapshot},
+	}
+
+	for _, item := range items {
+		err := hash.Restore([]byte(item.data))
+		assert.Equal(t, item.err, err, item.data)
+
+		group, err := hash.GetGroup("werbenhu1")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(group.Elements))
+		assert.Equal(t, 1, len(hash.groups))
+	}
+}
+
+func TestRestoreLimits(t *testing.T) {
+	hash := New()
+	data := []byte(`{"werbenhu1":{"name":"werbenhu1","numberOfReplicas":20,"elements":{"a":{"key":"a"},"b":{"key":"b"}}},"werbenhu2":{"name":"werbenhu2","numberOfReplicas":10}}`)
+
+	err := hash.RestoreWithOptions(data, RestoreOptions{MaxGroups: 1})
+	assert.Equal(t, ErrTooManyGroups, err)
+
+	err = hash.RestoreWithOptions(data, RestoreOptions{MaxElements: 1})
+	assert.Equal(t, ErrTooManyElements, err)
+
+	err = hash.RestoreWithOptions(data, RestoreOptions{MaxReplicas: 15})
+	assert.Equal(t, ErrInvalidReplicas, err)
+	assert.Equal(t, 0, len(hash.groups))
+
+	err = hash.RestoreWithOptions(data, RestoreOptions{MaxPoints: 39})
+	assert.Equal(t, ErrTooManyPoints, err)
+	assert.Equal(t, 0, len(hash.groups))
+
+	err = hash.RestoreWithOptions(data, RestoreOptions{MaxGroups: -1, MaxElements: 2, MaxReplicas: 20, MaxPoints: 40})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(hash.groups))
+	assert.Equal(t, 40, len(hash.groups["werbenhu1"].circle))
+	assert.Equal(t, 40, len(hash.groups["werbenhu1"].rows))
+}
+
+func TestRestoreMerge(t *testing.T) {
+	hash := New()
+	hash.CreateGroup("werbenhu1", 100)
+	hash.CreateGroup("werbenhu2", 100)
+	hash.Insert("werbenhu1", "192.168.1.101:8080", []byte("werbenhu101"))
+	hash.Insert("werbenhu2", "192.168.2.101:8080", []byte("werbenhu201"))
+
+	data := []byte(`{"werbenhu2":{"name":"werbenhu2","numberOfReplicas":10},"werbenhu3":{"name":"werbenhu3","numberOfReplicas":10}}`)
+	err := hash.RestoreWithOptions(data, RestoreOptions{Mode: RestoreMerge, MaxGroups: 2})
+	assert.Equal(t, ErrTooManyGroups, err)
+	assert.Equal(t, 2, len(hash.groups))
+
+	err = hash.RestoreWithOptions(data, RestoreOptions{Mode: RestoreMerge})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(hash.groups))
+
+	group1, err := hash.GetGroup("werbenhu1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(group1.Elements))
+
+	group2, err := hash.GetGroup("werbenhu2")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(group2.Elements))
+	assert.Equal(t, 10, group2.NumberOfReplicas)
+
+	_, err = hash.GetGroup("werbenhu3")
+	assert.Nil(t, err)
+}
+
+func TestRestoreReplace(t *testing.T) {
+	hash := New()
+	hash.CreateGroup("werbenhu1", 100)
+
+	data := []byte(`{"werbenhu2":{"name":"werbenhu2","numberOfReplicas":10,"elements":{"a":{"key":"a","payload":"d2VyYmVu"}}}}`)
+	err := hash.RestoreWithOptions(data, RestoreOptions{Mode: RestoreReplace})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hash.groups))
+
+	_, err = hash.GetGroup("werbenhu1")
+	assert.Equal(t, ErrGroupNotFound, err)
+
+	key, payload, err := hash.Match("werbenhu2", "werbenhuxxxxx")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", key)
+	assert.Equal(t, []byte("werben"), payload)
+}
+
+func TestSingletonRestoreWithOptions(t *testing.T) {
+	singleton = nil
+	data := []byte(`{"werbenhu1":{"name":"werbenhu1","numberOfReplicas":10}}`)
+	err := RestoreWithOptions(data, RestoreOptions{MaxReplicas: 5})
+	assert.Equal(t, ErrInvalidReplicas, err)
+	assert.NotNil(t, singleton)
+
+	err = RestoreWithOptions(data, RestoreOptions{Mode: RestoreMerge})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(singleton.groups))
+}
+
+func TestRestoreKeepsGroupHandles(t *testing.T) {
+	hash := New()
+	group1, _ := hash.CreateGroup("werbenhu1", 100)
+	group2, _ := hash.CreateGroup("werbenhu2", 100)
+	group1.Insert("192.168.1.101:8080", []byte("werbenhu101"))
+	group2.Insert("192.168.2.101:8080", []byte("werbenhu201"))
+
+	data := []byte(`{"werbenhu1":{"name":"werbenhu1","numberOfReplicas":10,"elements":{"192.168.1.102:8080":{"key":"192.168.1.102:8080","payload":"d2VyYmVuaHUxMDI="}}}}`)
+	err := hash.Restore(data)
+	assert.Nil(t, err)
+
+	existing, err := hash.GetGroup("werbenhu1")
+	assert.Nil(t, err)
+	assert.True(t, existing == group1)
+	assert.Equal(t, 10, group1.NumberOfReplicas)
+	assert.Equal(t, 10, len(group1.circle))
+
+	key, payload, err := group1.Match("werbenhuxxxxx")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.1.102:8080", key)
+	assert.Equal(t, []byte("werbenhu102"), payload)
+
+	_, _, err = group2.Match("werbenhuxxxxx")
+	assert.Equal(t, ErrGroupRemoved, err)
+	assert.Equal(t, ErrGroupRemoved, group2.Insert("192.168.2.102:8080", nil))
+	assert.Equal(t, ErrGroupRemoved, group2.Upsert("192.168.2.102:8080", nil))
+	assert.Equal(t, ErrGroupRemoved, group2.Delete("192.168.2.101:8080"))
+	_, err = group2.Add("192.168.2.102:8080", nil)
+	assert.Equal(t, ErrGroupRemoved, err)
+	_, err = group2.Remove("192.168.2.101:8080")
+	assert.Equal(t, ErrGroupRemoved, err)
+	assert.Equal(t, 0, len(group2.GetElements()))
+}
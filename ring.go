@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+// keyspace is the number of positions on the circle, every CRC32 value
+const keyspace = uint64(1) << 32
+
+// ring is an immutable view of a group's circle. Each point owns the arc
+// from itself up to the next point, the last point also owns the arc
+// that wraps around to the first one, just like Circle.Match.
+type ring struct {
+	points Circle
+	owners []string
+}
+
+// snapshotRing copies the distinct points of the circle and their owners.
+// The caller must hold the group lock.
+func (b *Group) snapshotRing() ring {
+	r := ring{
+		points: make(Circle, 0, len(b.circle)),
+		owners: make([]string, 0, len(b.circle)),
+	}
+	for i, point := range b.circle {
+		if i > 0 && b.circle[i-1] == point {
+			continue
+		}
+		element, ok := b.rows[point]
+		if !ok {
+			continue
+		}
+		r.points = append(r.points, point)
+		r.owners = append(r.owners, element.Key)
+	}
+	return r
+}
+
+// ring takes a snapshot of the group's circle under the group lock
+func (b *Group) ring() ring {
+	b.RLock()
+	defer b.RUnlock()
+	return b.snapshotRing()
+}
+
+// owner returns the element key owning the given position, or "" for an empty ring
+func (r ring) owner(target uint32) string {
+	if i, ok := r.points.Match(target); ok {
+		return r.owners[i]
+	}
+	return ""
+}
+
+// arc returns the length of the arc owned by the i-th point
+func (r ring) arc(i int) uint64 {
+	if len(r.points) == 1 {
+		return keyspace
+	}
+	if i == len(r.points)-1 {
+		return keyspace - uint64(r.points[i]) + uint64(r.points[0])
+	}
+	return uint64(r.points[i+1]) - uint64(r.points[i])
+}
+
+// ownership returns the fraction of the keyspace owned by each element
+func (r ring) ownership() map[string]float64 {
+	owned := make(map[string]float64)
+	for i, owner := range r.owners {
+		owned[owner] += float64(r.arc(i)) / float64(keyspace)
+	}
+	return owned
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupRing(t *testing.T) {
+	a, b := &Element{Key: "a"}, &Element{Key: "b"}
+	group := NewGroup("test", 1)
+	group.circle = Circle{10, 20, 20, 30}
+	group.rows = map[uint32]*Element{10: a, 20: b}
+
+	r := group.ring()
+	assert.Equal(t, Circle{10, 20}, r.points)
+	assert.Equal(t, []string{"a", "b"}, r.owners)
+}
+
+func TestRingOwner(t *testing.T) {
+	r := ring{points: Circle{10, 20}, owners: []string{"a", "b"}}
+	assert.Equal(t, "b", r.owner(0))
+	assert.Equal(t, "a", r.owner(10))
+	assert.Equal(t, "a", r.owner(19))
+	assert.Equal(t, "b", r.owner(20))
+	assert.Equal(t, "b", r.owner(1<<32-1))
+	assert.Equal(t, "", ring{}.owner(10))
+}
+
+func TestRingArc(t *testing.T) {
+	r := ring{points: Circle{10, 20}, owners: []string{"a", "b"}}
+	assert.Equal(t, uint64(10), r.arc(0))
+	assert.Equal(t, keyspace-10, r.arc(1))
+
+	single := ring{points: Circle{10}, owners: []string{"a"}}
+	assert.Equal(t, keyspace, single.arc(0))
+}
+
+func TestRingOwnership(t *testing.T) {
+	r := ring{points: Circle{0, 1 << 30, 1 << 31}, owners: []string{"a", "b", "a"}}
+	assert.Equal(t, map[string]float64{"a": 0.75, "b": 0.25}, r.ownership())
+	assert.Equal(t, map[string]float64{}, ring{}.ownership())
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"sort"
+)
+
+// ChangeOp is the kind of a hypothetical change passed to Simulate
+type ChangeOp int
+
+const (
+	// ChangeInsert inserts a new element.
+	ChangeInsert ChangeOp = iota + 1
+
+	// ChangeDelete deletes an existing element.
+	ChangeDelete
+
+	// ChangeReplicas changes the number of replicas of the group. Elements have
+	// no individual weights, the group-wide replica count is the only weight.
+	ChangeReplicas
+)
+
+// Change is a hypothetical membership change
+type Change struct {
+	Op       ChangeOp `json:"op"`
+	Key      string   `json:"key,omitempty"`
+	Payload  []byte   `json:"payload,omitempty"`
+	Replicas int      `json:"replicas,omitempty"`
+}
+
+// Ownership is the fraction of the keyspace an element owns before and after the changes
+type Ownership struct {
+	Key    string  `json:"key"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// Simulation is the predicted impact of a set of changes
+type Simulation struct {
+	// Ownership lists every element present before or after the changes, sorted by key.
+	Ownership []Ownership `json:"ownership"`
+
+	// Remapped is the fraction of the keyspace whose owner changes.
+	Remapped float64 `json:"remapped"`
+
+	// MaxIncrease is the largest growth of the keyspace fraction owned by
+	// a single element, and MaxIncreaseKey that element.
+	MaxIncrease    float64 `json:"maxIncrease"`
+	MaxIncreaseKey string  `json:"maxIncreaseKey,omitempty"`
+}
+
+// apply applies a hypothetical change to the group
+func (b *Group) apply(change Change) error {
+	switch change.Op {
+	case ChangeInsert:
+		return b.Insert(change.Key, change.Payload)
+	case ChangeDelete:
+		b.RLock()
+		_, ok := b.Elements[change.Key]
+		b.RUnlock()
+		if !ok {
+			return ErrKeyNotFound
+		}
+		return b.Delete(change.Key)
+	case ChangeReplicas:
+		if change.Replicas <= 0 {
+			return ErrInvalidReplicas
+		}
+		b.setReplicas(change.Replicas)
+		return nil
+	}
+	return ErrInvalidChange
+}
+
+// Simulate applies the changes in order to a copy of the group and reports
+// how ownership of the keyspace would change. The group itself is not modified.
+func (b *Group) Simulate(changes []Change) (*Simulation, error) {
+	b.RLock()
+	removed := b.removed
+	b.RUnlock()
+	if removed {
+		return nil, ErrGroupRemoved
+	}
+
+	clone := b.Clone()
+	before := clone.ring()
+	for _, change := range changes {
+		if err := clone.apply(change); err != nil {
+			return nil, err
+		}
+	}
+	after := clone.ring()
+
+	beforeOwned, afterOwned := before.ownership(), after.ownership()
+	keys := make([]string, 0, len(beforeOwned)+len(afterOwned))
+	for key := range beforeOwned {
+		keys = append(keys, key)
+	}
+	for key := range afterOwned {
+		if _, ok := beforeOwned[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	sim := &Simulation{
+		Ownership: make([]Ownership, 0, len(keys)),
+		Remapped:  diffRings(before, after).Moved,
+	}
+	for _, key := range keys {
+		o := Ownership{Key: key, Before: beforeOwned[key], After: afterOwned[key]}
+		sim.Ownership = append(sim.Ownership, o)
+		if increase := o.After - o.Before; increase > sim.MaxIncrease {
+			sim.MaxIncrease = increase
+			sim.MaxIncreaseKey = key
+		}
+	}
+	return sim, nil
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupSimulate(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	group.Insert("192.168.1.101:1883", []byte("werbenhu101"))
+
+	sim, err := group.Simulate([]Change{
+		{Op: ChangeInsert, Key: "192.168.1.102:1883"},
+		{Op: ChangeDelete, Key: "192.168.1.100:1883"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(group.Elements))
+	assert.Equal(t, uint64(2), group.Version())
+
+	assert.Equal(t, 3, len(sim.Ownership))
+	assert.Equal(t, "192.168.1.100:1883", sim.Ownership[0].Key)
+	assert.Equal(t, float64(0), sim.Ownership[0].After)
+	assert.Equal(t, "192.168.1.102:1883", sim.Ownership[2].Key)
+	assert.Equal(t, float64(0), sim.Ownership[2].Before)
+
+	before, after := 0.0, 0.0
+	for _, o := range sim.Ownership {
+		before += o.Before
+		after += o.After
+	}
+	assert.InDelta(t, 1, before, 1e-9)
+	assert.InDelta(t, 1, after, 1e-9)
+
+	assert.Equal(t, "192.168.1.102:1883", sim.MaxIncreaseKey)
+	assert.Equal(t, sim.Ownership[2].After, sim.MaxIncrease)
+	assert.True(t, sim.Remapped >= sim.Ownership[0].Before)
+	assert.True(t, sim.Remapped <= 1)
+}
+
+func TestGroupSimulateReplicas(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", nil)
+	group.Insert("192.168.1.101:1883", nil)
+
+	sim, err := group.Simulate([]Change{{Op: ChangeReplicas, Replicas: 10}})
+	assert.Nil(t, err)
+	assert.Equal(t, 100, group.NumberOfReplicas)
+	assert.True(t, sim.Remapped > 0)
+
+	sim, err = group.Simulate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), sim.Remapped)
+	assert.Equal(t, float64(0), sim.MaxIncrease)
+	assert.Equal(t, "", sim.MaxIncreaseKey)
+}
+
+func TestGroupSimulateErrors(t *testing.T) {
+	hash := New()
+	group, _ := hash.CreateGroup("test", 100)
+	group.Insert("192.168.1.100:1883", nil)
+
+	_, err := group.Simulate([]Change{{Op: ChangeInsert, Key: "192.168.1.100:1883"}})
+	assert.Equal(t, ErrKeyExisted, err)
+
+	_, err = group.Simulate([]Change{{Op: ChangeDelete, Key: "192.168.1.101:1883"}})
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = group.Simulate([]Change{{Op: ChangeReplicas}})
+	assert.Equal(t, ErrInvalidReplicas, err)
+
+	_, err = group.Simulate([]Change{{Op: ChangeOp(0)}})
+	assert.Equal(t, ErrInvalidChange, err)
+
+	hash.RemoveGroup("test")
+	_, err = group.Simulate(nil)
+	assert.Equal(t, ErrGroupRemoved, err)
+}
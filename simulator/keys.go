@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package simulator
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/werbenhu/chash"
+)
+
+// Key distributions understood by NewStream
+const (
+	Uniform    = "uniform"
+	Zipf       = "zipf"
+	Sequential = "sequential"
+)
+
+// DefaultZipfS is the skew of Zipf streams when none is given
+const DefaultZipfS = 1.1
+
+// StreamOptions describe a synthetic key stream
+type StreamOptions struct {
+	// Distribution is Uniform, Zipf or Sequential.
+	Distribution string
+
+	// Keys is the number of keys the stream yields.
+	Keys int
+
+	// Seed makes random streams reproducible.
+	Seed int64
+
+	// ZipfS is the skew of a Zipf stream, it must be greater than 1.
+	// 0 means DefaultZipfS.
+	ZipfS float64
+
+	// Prefix is prepended to every key, e.g. "user-id-" for sequential IDs.
+	Prefix string
+}
+
+// stream yields keys produced by a function until n keys were produced
+type stream struct {
+	n    int
+	next func(i int) string
+	i    int
+	key  string
+}
+
+func (s *stream) Next() bool {
+	if s.i >= s.n {
+		return false
+	}
+	s.key = s.next(s.i)
+	s.i++
+	return true
+}
+
+func (s *stream) Key() string {
+	return s.key
+}
+
+func (s *stream) Err() error {
+	return nil
+}
+
+// NewStream creates a synthetic key stream:
+// Uniform draws random keys, Zipf draws keys from a set of Keys distinct keys
+// where a few are far more frequent than the rest, and Sequential yields
+// Prefix0, Prefix1, and so on.
+func NewStream(opts StreamOptions) (chash.KeyIterator, error) {
+	if opts.Keys < 0 {
+		return nil, ErrInvalidStream
+	}
+	r := rand.New(rand.NewSource(opts.Seed))
+	switch opts.Distribution {
+	case Uniform:
+		return &stream{n: opts.Keys, next: func(int) string {
+			return opts.Prefix + strconv.FormatUint(r.Uint64(), 16)
+		}}, nil
+	case Zipf:
+		s := opts.ZipfS
+		if s == 0 {
+			s = DefaultZipfS
+		}
+		if s <= 1 || opts.Keys == 0 {
+			return nil, ErrInvalidStream
+		}
+		z := rand.NewZipf(r, s, 1, uint64(opts.Keys-1))
+		return &stream{n: opts.Keys, next: func(int) string {
+			return opts.Prefix + strconv.FormatUint(z.Uint64(), 10)
+		}}, nil
+	case Sequential:
+		return &stream{n: opts.Keys, next: func(i int) string {
+			return opts.Prefix + strconv.Itoa(i)
+		}}, nil
+	}
+	return nil, ErrInvalidStream
+}
+
+// traceIterator yields the non-empty lines of a trace
+type traceIterator struct {
+	scanner *bufio.Scanner
+	key     string
+}
+
+func (t *traceIterator) Next() bool {
+	for t.scanner.Scan() {
+		if key := strings.TrimSpace(t.scanner.Text()); key != "" {
+			t.key = key
+			return true
+		}
+	}
+	return false
+}
+
+func (t *traceIterator) Key() string {
+	return t.key
+}
+
+func (t *traceIterator) Err() error {
+	return t.scanner.Err()
+}
+
+// NewTrace replays a recorded trace with one lookup key per line, blank lines are skipped
+func NewTrace(r io.Reader) chash.KeyIterator {
+	return &traceIterator{scanner: bufio.NewScanner(r)}
+}
+
+// Collect reads up to max keys from the iterator, all of them if max is not positive
+func Collect(keys chash.KeyIterator, max int) ([]string, error) {
+	collected := make([]string, 0)
+	for (max <= 0 || len(collected) < max) && keys.Next() {
+		collected = append(collected, keys.Key())
+	}
+	return collected, keys.Err()
+}
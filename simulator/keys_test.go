@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package simulator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStream(t *testing.T) {
+	stream, err := NewStream(StreamOptions{Distribution: Sequential, Keys: 3, Prefix: "user-id-"})
+	assert.Nil(t, err)
+	keys, err := Collect(stream, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-id-0", "user-id-1", "user-id-2"}, keys)
+
+	stream, _ = NewStream(StreamOptions{Distribution: Uniform, Keys: 100, Seed: 1})
+	keys, _ = Collect(stream, 0)
+	again, _ := NewStream(StreamOptions{Distribution: Uniform, Keys: 100, Seed: 1})
+	same, _ := Collect(again, 0)
+	assert.Equal(t, 100, len(keys))
+	assert.Equal(t, keys, same)
+
+	stream, _ = NewStream(StreamOptions{Distribution: Zipf, Keys: 10000, Seed: 1})
+	keys, _ = Collect(stream, 0)
+	counts := make(map[string]int)
+	for _, key := range keys {
+		counts[key]++
+	}
+	assert.True(t, counts["0"] > counts["100"])
+	assert.True(t, len(counts) < 10000)
+
+	_, err = NewStream(StreamOptions{Distribution: Zipf, Keys: 10, ZipfS: 1})
+	assert.Equal(t, ErrInvalidStream, err)
+	_, err = NewStream(StreamOptions{Distribution: "gauss", Keys: 10})
+	assert.Equal(t, ErrInvalidStream, err)
+	_, err = NewStream(StreamOptions{Distribution: Uniform, Keys: -1})
+	assert.Equal(t, ErrInvalidStream, err)
+}
+
+func TestNewTrace(t *testing.T) {
+	keys, err := Collect(NewTrace(strings.NewReader("user-id-1\n\n  user-id-2 \nuser-id-1\nuser-id-3\n")), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user-id-1", "user-id-2", "user-id-1"}, keys)
+}
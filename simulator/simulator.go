@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+// Package simulator measures how evenly a group spreads a stream of lookup keys,
+// how many keys move when membership changes, and how fast lookups are, to choose
+// NumberOfReplicas, an algorithm and a hasher from data rather than guesses.
+package simulator
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/werbenhu/chash"
+)
+
+// Defaults used when the corresponding Config field is empty
+const (
+	DefaultElements = 10
+	DefaultReplicas = 100
+)
+
+// ErrInvalidStream is returned for key stream options that cannot produce keys
+var ErrInvalidStream = errors.New("simulator: invalid key stream")
+
+// ErrNoKeys is returned when a simulation is run without keys
+var ErrNoKeys = errors.New("simulator: no keys")
+
+// Config describes the groups to simulate. Every combination of algorithm,
+// hasher and replicas is simulated with the same elements and keys.
+type Config struct {
+	// Elements is the number of elements of the group, 0 meaning DefaultElements.
+	Elements int `json:"elements"`
+
+	// Replicas lists the numbers of replicas to compare, empty meaning DefaultReplicas.
+	Replicas []int `json:"replicas"`
+
+	// Algorithms and Hashers list the placement algorithms and hash functions to
+	// compare, empty meaning chash.AlgorithmRing and chash.HasherCRC32, which are
+	// currently the only ones available.
+	Algorithms []string `json:"algorithms"`
+	Hashers    []string `json:"hashers"`
+}
+
+// Remap is the effect of a single membership change
+type Remap struct {
+	// Change describes the change, e.g. "add element-10".
+	Change string `json:"change"`
+
+	// Moved is the number of keys whose element changed.
+	Moved int `json:"moved"`
+
+	// MovedRatio is Moved divided by the number of keys, and IdealRatio is the
+	// smallest ratio possible for the change, 1/n of the keys for n elements.
+	MovedRatio float64 `json:"movedRatio"`
+	IdealRatio float64 `json:"idealRatio"`
+}
+
+// Result is the outcome of simulating one combination
+type Result struct {
+	Algorithm string `json:"algorithm"`
+	Hasher    string `json:"hasher"`
+	Replicas  int    `json:"replicas"`
+	Elements  int    `json:"elements"`
+	Keys      int    `json:"keys"`
+
+	// MinLoad and MaxLoad are the fewest and most keys matched to one element.
+	MinLoad int `json:"minLoad"`
+	MaxLoad int `json:"maxLoad"`
+
+	// MaxMeanRatio is MaxLoad divided by the mean load, 1 meaning a perfect spread,
+	// and StdDev is the standard deviation of the load relative to the mean.
+	MaxMeanRatio float64 `json:"maxMeanRatio"`
+	StdDev       float64 `json:"stdDev"`
+
+	// Remaps lists the keys moved by adding an element and by removing one.
+	Remaps []Remap `json:"remaps"`
+
+	// LookupsPerSecond is the measured throughput of Group.Match.
+	LookupsPerSecond float64 `json:"lookupsPerSecond"`
+}
+
+// elementKey names the i-th simulated element
+func elementKey(i int) string {
+	return "element-" + strconv.Itoa(i)
+}
+
+// withDefaults fills the empty fields of the config and checks it
+func (cfg Config) withDefaults() (Config, error) {
+	if cfg.Elements == 0 {
+		cfg.Elements = DefaultElements
+	}
+	if cfg.Elements < 0 {
+		return cfg, chash.ErrInvalidConfig
+	}
+	if len(cfg.Replicas) == 0 {
+		cfg.Replicas = []int{DefaultReplicas}
+	}
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = []string{chash.AlgorithmRing}
+	}
+	if len(cfg.Hashers) == 0 {
+		cfg.Hashers = []string{chash.HasherCRC32}
+	}
+	for _, replicas := range cfg.Replicas {
+		if replicas <= 0 || replicas > chash.DefaultMaxReplicas {
+			return cfg, chash.ErrInvalidReplicas
+		}
+	}
+	for _, algorithm := range cfg.Algorithms {
+		if algorithm != chash.AlgorithmRing {
+			return cfg, chash.ErrUnsupportedAlgorithm
+		}
+	}
+	for _, hasher := range cfg.Hashers {
+		if hasher != chash.HasherCRC32 {
+			return cfg, chash.ErrUnsupportedHasher
+		}
+	}
+	return cfg, nil
+}
+
+// owners matches every key and returns the element of each key
+func owners(group *chash.Group, keys []string) []string {
+	matched := make([]string, len(keys))
+	for i, key := range keys {
+		matched[i], _, _ = group.Match(key)
+	}
+	return matched
+}
+
+// remap counts the keys whose element differs from before after a change
+func remap(change string, group *chash.Group, keys []string, before []string, ideal float64) Remap {
+	r := Remap{Change: change, IdealRatio: ideal}
+	for i, owner := range owners(group, keys) {
+		if owner != before[i] {
+			r.Moved++
+		}
+	}
+	r.MovedRatio = float64(r.Moved) / float64(len(keys))
+	return r
+}
+
+// simulate runs the keys against a single combination
+func simulate(keys []string, algorithm string, hasher string, replicas int, elements int) Result {
+	group := chash.NewGroup("simulation", replicas)
+	for i := 0; i < elements; i++ {
+		group.Insert(elementKey(i), nil)
+	}
+	result := Result{
+		Algorithm: algorithm,
+		Hasher:    hasher,
+		Replicas:  replicas,
+		Elements:  elements,
+		Keys:      len(keys),
+	}
+
+	start := time.Now()
+	before := owners(group, keys)
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		result.LookupsPerSecond = float64(len(keys)) / elapsed
+	}
+
+	loads := make(map[string]int, elements)
+	for _, owner := range before {
+		loads[owner]++
+	}
+	mean := float64(len(keys)) / float64(elements)
+	result.MinLoad = len(keys)
+	variance := 0.0
+	for i := 0; i < elements; i++ {
+		load := loads[elementKey(i)]
+		if load < result.MinLoad {
+			result.MinLoad = load
+		}
+		if load > result.MaxLoad {
+			result.MaxLoad = load
+		}
+		variance += (float64(load) - mean) * (float64(load) - mean)
+	}
+	result.MaxMeanRatio = float64(result.MaxLoad) / mean
+	result.StdDev = math.Sqrt(variance/float64(elements)) / mean
+
+	added := group.Clone()
+	added.Insert(elementKey(elements), nil)
+	result.Remaps = append(result.Remaps,
+		remap("add "+elementKey(elements), added, keys, before, 1/float64(elements+1)))
+
+	if elements > 1 {
+		removed := group.Clone()
+		removed.Delete(elementKey(0))
+		result.Remaps = append(result.Remaps,
+			remap("remove "+elementKey(0), removed, keys, before, 1/float64(elements)))
+	}
+	return result
+}
+
+// Run simulates every combination of the config against the same keys
+func Run(keys []string, cfg Config) ([]Result, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(cfg.Algorithms)*len(cfg.Hashers)*len(cfg.Replicas))
+	for _, algorithm := range cfg.Algorithms {
+		for _, hasher := range cfg.Hashers {
+			for _, replicas := range cfg.Replicas {
+				results = append(results, simulate(keys, algorithm, hasher, replicas, cfg.Elements))
+			}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package simulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/werbenhu/chash"
+)
+
+func TestRun(t *testing.T) {
+	stream, _ := NewStream(StreamOptions{Distribution: Sequential, Keys: 20000, Prefix: "user-id-"})
+	keys, _ := Collect(stream, 0)
+
+	results, err := Run(keys, Config{Elements: 5, Replicas: []int{1, 1000}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+
+	for _, r := range results {
+		assert.Equal(t, chash.AlgorithmRing, r.Algorithm)
+		assert.Equal(t, chash.HasherCRC32, r.Hasher)
+		assert.Equal(t, 5, r.Elements)
+		assert.Equal(t, 20000, r.Keys)
+		assert.True(t, r.MinLoad <= r.MaxLoad)
+		assert.True(t, r.MaxMeanRatio >= 1)
+		assert.True(t, r.LookupsPerSecond > 0)
+		assert.Equal(t, 2, len(r.Remaps))
+		assert.Equal(t, "add element-5", r.Remaps[0].Change)
+		assert.InDelta(t, 1.0/6, r.Remaps[0].IdealRatio, 1e-9)
+		assert.Equal(t, "remove element-0", r.Remaps[1].Change)
+		assert.InDelta(t, 0.2, r.Remaps[1].IdealRatio, 1e-9)
+	}
+
+	// more replicas spread the keys more evenly
+	assert.Equal(t, 1, results[0].Replicas)
+	assert.Equal(t, 1000, results[1].Replicas)
+	assert.True(t, results[1].MaxMeanRatio < results[0].MaxMeanRatio)
+	assert.True(t, results[1].MaxMeanRatio < 1.2)
+	assert.InDelta(t, 1.0/6, results[1].Remaps[0].MovedRatio, 0.05)
+}
+
+func TestRunInvalid(t *testing.T) {
+	_, err := Run(nil, Config{})
+	assert.Equal(t, ErrNoKeys, err)
+
+	keys := []string{"user-id-1"}
+	_, err = Run(keys, Config{Replicas: []int{0}})
+	assert.Equal(t, chash.ErrInvalidReplicas, err)
+	_, err = Run(keys, Config{Elements: -1})
+	assert.Equal(t, chash.ErrInvalidConfig, err)
+	_, err = Run(keys, Config{Algorithms: []string{"jump"}})
+	assert.Equal(t, chash.ErrUnsupportedAlgorithm, err)
+	_, err = Run(keys, Config{Hashers: []string{"xxhash"}})
+	assert.Equal(t, chash.ErrUnsupportedHasher, err)
+
+	results, err := Run(keys, Config{Elements: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results[0].Remaps))
+}
@@ -12,7 +12,8 @@ var (
 )
 
 // CreateGroup creates a new group in the CHash instance and returns a pointer to
-// the Group object. If the group already exists, it returns an error.
+// the Group object. If the group already exists, it returns an error, as it does
+// with ErrInvalidReplicas if replicas is not positive.
 func CreateGroup(groupName string, replicas int) (*Group, error) {
 	mu.Lock()
 	defer mu.Unlock()
@@ -75,3 +76,35 @@ func Restore(data []byte) error {
 	}
 	return singleton.Restore(data)
 }
+
+// RestoreWithOptions restores the CHash object from serialized data using the given options.
+func RestoreWithOptions(data []byte, opts RestoreOptions) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if singleton == nil {
+		singleton = New()
+	}
+	return singleton.RestoreWithOptions(data, opts)
+}
+
+// ApplyConfig reconciles the CHash object with the given config.
+func ApplyConfig(cfg *Config) ([]ConfigChange, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if singleton == nil {
+		singleton = New()
+	}
+	return singleton.ApplyConfig(cfg)
+}
+
+// PublishExpvar publishes the state of the CHash object under the given expvar name.
+func PublishExpvar(name string, opts ExpvarOptions) error {
+	return publishExpvar(name, func() interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		if singleton == nil {
+			singleton = New()
+		}
+		return singleton.expvarValue(opts)
+	})
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"math"
+	"sort"
+)
+
+// ElementStats describes the share of the circle owned by a single element
+type ElementStats struct {
+	Key string `json:"key"`
+
+	// Points is the number of distinct points of the element on the circle.
+	Points int `json:"points"`
+
+	// Ownership is the fraction of the 2^32 keyspace owned by the element.
+	Ownership float64 `json:"ownership"`
+
+	// LargestArc and SmallestArc are the lengths of the largest and smallest
+	// arcs owned by a single point of the element.
+	LargestArc  uint64 `json:"largestArc"`
+	SmallestArc uint64 `json:"smallestArc"`
+}
+
+// GroupStats describes how evenly the circle of a group is spread over its elements
+type GroupStats struct {
+	Name     string `json:"name"`
+	Replicas int    `json:"replicas"`
+
+	// Points is the number of distinct points on the circle.
+	Points int `json:"points"`
+
+	// Elements lists the statistics of every element, sorted by key.
+	Elements []ElementStats `json:"elements"`
+
+	// StdDev is the standard deviation of the ownership of the elements.
+	StdDev float64 `json:"stdDev"`
+
+	// MaxMeanRatio is the largest ownership divided by the mean ownership,
+	// 1 meaning a perfectly even spread.
+	MaxMeanRatio float64 `json:"maxMeanRatio"`
+
+	// Collisions is the number of virtual nodes that landed on a position
+	// already taken by another virtual node.
+	Collisions int `json:"collisions"`
+}
+
+// Stats computes ownership and distribution statistics from the group's circle
+func (b *Group) Stats() GroupStats {
+	b.RLock()
+	defer b.RUnlock()
+
+	stats := GroupStats{
+		Name:     b.Name,
+		Replicas: b.NumberOfReplicas,
+		Elements: make([]ElementStats, 0, len(b.Elements)),
+	}
+	for i := 1; i < len(b.circle); i++ {
+		if b.circle[i] == b.circle[i-1] {
+			stats.Collisions++
+		}
+	}
+
+	r := b.snapshotRing()
+	stats.Points = len(r.points)
+	byKey := make(map[string]*ElementStats, len(b.Elements))
+	for key := range b.Elements {
+		stats.Elements = append(stats.Elements, ElementStats{Key: key})
+	}
+	sort.Slice(stats.Elements, func(i, j int) bool {
+		return stats.Elements[i].Key < stats.Elements[j].Key
+	})
+	for i := range stats.Elements {
+		byKey[stats.Elements[i].Key] = &stats.Elements[i]
+	}
+
+	for i, owner := range r.owners {
+		es, ok := byKey[owner]
+		if !ok {
+			continue
+		}
+		arc := r.arc(i)
+		es.Points++
+		es.Ownership += float64(arc) / float64(keyspace)
+		if arc > es.LargestArc {
+			es.LargestArc = arc
+		}
+		if es.SmallestArc == 0 || arc < es.SmallestArc {
+			es.SmallestArc = arc
+		}
+	}
+
+	if len(stats.Elements) == 0 || len(r.points) == 0 {
+		return stats
+	}
+	mean := 1 / float64(len(stats.Elements))
+	max, variance := 0.0, 0.0
+	for _, es := range stats.Elements {
+		if es.Ownership > max {
+			max = es.Ownership
+		}
+		variance += (es.Ownership - mean) * (es.Ownership - mean)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(stats.Elements)))
+	stats.MaxMeanRatio = max / mean
+	return stats
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupStatsCircle(t *testing.T) {
+	a, b := &Element{Key: "a"}, &Element{Key: "b"}
+	group := NewGroup("test", 2)
+	group.Elements = map[string]*Element{"a": a, "b": b, "c": {Key: "c"}}
+	group.circle = Circle{0, 1 << 30, 1 << 30, 1 << 31, 3 << 30}
+	group.rows = map[uint32]*Element{0: a, 1 << 30: b, 1 << 31: a, 3 << 30: a}
+
+	stats := group.Stats()
+	assert.Equal(t, "test", stats.Name)
+	assert.Equal(t, 2, stats.Replicas)
+	assert.Equal(t, 4, stats.Points)
+	assert.Equal(t, 1, stats.Collisions)
+	assert.Equal(t, []ElementStats{
+		{Key: "a", Points: 3, Ownership: 0.75, LargestArc: 1 << 30, SmallestArc: 1 << 30},
+		{Key: "b", Points: 1, Ownership: 0.25, LargestArc: 1 << 30, SmallestArc: 1 << 30},
+		{Key: "c"},
+	}, stats.Elements)
+	assert.InDelta(t, 0.3118, stats.StdDev, 1e-4)
+	assert.InDelta(t, 2.25, stats.MaxMeanRatio, 1e-9)
+}
+
+func TestGroupStats(t *testing.T) {
+	group := NewGroup("test", 1000)
+	stats := group.Stats()
+	assert.Equal(t, 0, len(stats.Elements))
+	assert.Equal(t, float64(0), stats.MaxMeanRatio)
+
+	group.Insert("192.168.1.100:1883", nil)
+	group.Insert("192.168.1.101:1883", nil)
+	group.Insert("192.168.1.102:1883", nil)
+
+	stats = group.Stats()
+	assert.Equal(t, 3, len(stats.Elements))
+	assert.Equal(t, 3000-stats.Collisions, stats.Points)
+
+	total, points := 0.0, 0
+	for _, es := range stats.Elements {
+		total += es.Ownership
+		points += es.Points
+		assert.True(t, es.SmallestArc <= es.LargestArc)
+		assert.True(t, es.Ownership > 0.2 && es.Ownership < 0.5)
+	}
+	assert.InDelta(t, 1, total, 1e-9)
+	assert.Equal(t, stats.Points, points)
+	assert.True(t, stats.MaxMeanRatio >= 1)
+	assert.True(t, stats.StdDev < 0.1)
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+// stickyTable remembers which element each lookup key was matched to, up to capacity keys.
+// It has its own lock so Match can record assignments while holding the group read lock.
+//
+// Keys are kept in least recently matched order so a full table makes room for new keys.
+// Keys of draining elements are held out of that order and only leave the table when
+// they are released, or when their element is deleted or stops draining.
+type stickyTable struct {
+	mu       sync.Mutex
+	capacity int
+	owners   map[string]string
+	counts   map[string]int
+	recent   *list.List
+	items    map[string]*list.Element
+}
+
+// newStickyTable creates an empty table
+func newStickyTable(capacity int) *stickyTable {
+	return &stickyTable{
+		capacity: capacity,
+		owners:   make(map[string]string),
+		counts:   make(map[string]int),
+		recent:   list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the element a key is pinned to
+func (s *stickyTable) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner, ok := s.owners[key]
+	return owner, ok
+}
+
+// unpin removes a key, the caller must hold the table lock
+func (s *stickyTable) unpin(key string) string {
+	owner, ok := s.owners[key]
+	if !ok {
+		return ""
+	}
+	delete(s.owners, key)
+	if item, ok := s.items[key]; ok {
+		s.recent.Remove(item)
+		delete(s.items, key)
+	}
+	s.counts[owner]--
+	if s.counts[owner] == 0 {
+		delete(s.counts, owner)
+	}
+	return owner
+}
+
+// assign pins a key to an element and marks it as the most recently matched.
+// When the table is full, the least recently matched key that is not held is
+// unpinned to make room. New keys are ignored if all keys are held.
+func (s *stickyTable) assign(key string, owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.owners[key]
+	if ok && current == owner {
+		if item, ok := s.items[key]; ok {
+			s.recent.MoveToFront(item)
+		}
+		return
+	}
+	if !ok && len(s.owners) >= s.capacity {
+		oldest := s.recent.Back()
+		if oldest == nil {
+			return
+		}
+		s.unpin(oldest.Value.(string))
+	}
+	s.unpin(key)
+	s.owners[key] = owner
+	s.counts[owner]++
+	s.items[key] = s.recent.PushFront(key)
+}
+
+// hold keeps the keys of a draining element from being unpinned to make room
+func (s *stickyTable) hold(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, item := range s.items {
+		if s.owners[key] == owner {
+			s.recent.Remove(item)
+			delete(s.items, key)
+		}
+	}
+}
+
+// unhold makes the held keys of an element that stopped draining
+// the least recently matched ones again
+func (s *stickyTable) unhold(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, current := range s.owners {
+		if _, ok := s.items[key]; !ok && current == owner {
+			s.items[key] = s.recent.PushBack(key)
+		}
+	}
+}
+
+// release unpins a key and returns the element it was pinned to, or ""
+func (s *stickyTable) release(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unpin(key)
+}
+
+// count returns the number of keys pinned to an element
+func (s *stickyTable) count(owner string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[owner]
+}
+
+// keys returns the keys pinned to an element in ascending order
+func (s *stickyTable) keys(owner string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, s.counts[owner])
+	for key, current := range s.owners {
+		if current == owner {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// drop unpins every key of an element
+func (s *stickyTable) drop(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, current := range s.owners {
+		if current == owner {
+			s.unpin(key)
+		}
+	}
+}
+
+// retain unpins every key whose element is not in elements
+func (s *stickyTable) retain(elements map[string]*Element) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, owner := range s.owners {
+		if _, ok := elements[owner]; !ok {
+			s.unpin(key)
+		}
+	}
+}
+
+// stickyOwner returns the draining element a key is pinned to, or nil.
+// Keys pinned to other elements follow the circle. The caller must hold the group lock.
+func (b *Group) stickyOwner(key string) *Element {
+	if b.sticky == nil {
+		return nil
+	}
+	owner, ok := b.sticky.get(key)
+	if !ok || b.health[owner] != Draining {
+		return nil
+	}
+	return b.Elements[owner]
+}
+
+// finalize removes a draining element once no keys are pinned to it.
+// The caller must hold the group lock.
+func (b *Group) finalize(key string) {
+	if b.health[key] != Draining {
+		return
+	}
+	if b.sticky != nil && b.sticky.count(key) > 0 {
+		return
+	}
+	if _, ok := b.Elements[key]; ok {
+		b.remove(key)
+	}
+}
+
+// EnableSticky enables the sticky-assignment table, which remembers the element
+// each key was matched to for up to capacity keys. When the table is full, the
+// least recently matched key of an element that is not draining is forgotten,
+// keys pinned to draining elements are kept until they are released.
+// Any previous table is discarded.
+func (b *Group) EnableSticky(capacity int) error {
+	if capacity <= 0 {
+		return ErrInvalidCapacity
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	b.sticky = newStickyTable(capacity)
+	return nil
+}
+
+// DisableSticky discards the sticky-assignment table
+func (b *Group) DisableSticky() {
+	b.Lock()
+	defer b.Unlock()
+	b.sticky = nil
+}
+
+// Drain retires an element gracefully. New keys are matched to other elements
+// right away, while keys pinned to it in the sticky table keep matching it until
+// they are released. The element is deleted once no keys are pinned to it,
+// immediately if there are none or the sticky table is disabled.
+func (b *Group) Drain(key string) error {
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	if _, ok := b.Elements[key]; !ok {
+		return ErrKeyNotFound
+	}
+	b.setHealth(key, Draining)
+	b.finalize(key)
+	return nil
+}
+
+// StickyKeys returns the keys pinned to an element, e.g. the keys that still
+// need to be migrated away from a draining element
+func (b *Group) StickyKeys(element string) []string {
+	b.RLock()
+	defer b.RUnlock()
+	if b.sticky == nil {
+		return []string{}
+	}
+	return b.sticky.keys(element)
+}
+
+// Release unpins keys from the sticky table once their data has moved.
+// A draining element is deleted when its last key is released.
+func (b *Group) Release(keys ...string) error {
+	b.Lock()
+	defer b.Unlock()
+	if b.removed {
+		return ErrGroupRemoved
+	}
+	if b.sticky == nil {
+		return nil
+	}
+	for _, key := range keys {
+		if owner := b.sticky.release(key); owner != "" {
+			b.finalize(owner)
+		}
+	}
+	return nil
+}
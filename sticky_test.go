@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStickyTable(t *testing.T) {
+	s := newStickyTable(2)
+	s.assign("k1", "a")
+	s.assign("k2", "a")
+	s.assign("k1", "a")
+	s.assign("k3", "b")
+	assert.Equal(t, []string{"k1"}, s.keys("a"))
+	assert.Equal(t, []string{"k3"}, s.keys("b"))
+	_, ok := s.get("k2")
+	assert.False(t, ok)
+
+	s.assign("k3", "a")
+	assert.Equal(t, 2, s.count("a"))
+	assert.Equal(t, 0, s.count("b"))
+
+	owner, ok := s.get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, "a", owner)
+
+	assert.Equal(t, "a", s.release("k1"))
+	assert.Equal(t, "", s.release("k1"))
+	assert.Equal(t, 1, s.count("a"))
+
+	s.drop("a")
+	assert.Equal(t, 0, len(s.owners))
+	assert.Equal(t, 0, len(s.counts))
+	assert.Equal(t, 0, s.recent.Len())
+
+	s.assign("k1", "a")
+	s.hold("a")
+	s.assign("k2", "b")
+	s.assign("k3", "b")
+	assert.Equal(t, []string{"k1"}, s.keys("a"))
+	assert.Equal(t, []string{"k3"}, s.keys("b"))
+	s.unhold("a")
+	s.assign("k4", "b")
+	assert.Equal(t, 0, s.count("a"))
+	assert.Equal(t, []string{"k3", "k4"}, s.keys("b"))
+
+	s.hold("b")
+	s.assign("k5", "c")
+	assert.Equal(t, 0, s.count("c"))
+
+	s.drop("b")
+	s.assign("k1", "a")
+	s.assign("k2", "b")
+	s.retain(map[string]*Element{"b": {Key: "b"}})
+	assert.Equal(t, map[string]string{"k2": "b"}, s.owners)
+	assert.Equal(t, 1, s.recent.Len())
+}
+
+func TestGroupDrainSticky(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	group.Insert("192.168.1.101:1883", []byte("werbenhu101"))
+	assert.Equal(t, ErrInvalidCapacity, group.EnableSticky(0))
+	assert.Nil(t, group.EnableSticky(1000))
+
+	draining := "192.168.1.100:1883"
+	owners := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user-id-%d", i)
+		owners[key], _, _ = group.Match(key)
+	}
+	pinned := group.StickyKeys(draining)
+	assert.NotEqual(t, 0, len(pinned))
+
+	events := group.Watch(context.Background())
+	assert.Nil(t, group.Drain(draining))
+	assert.Equal(t, ErrKeyNotFound, group.Drain("192.168.1.102:1883"))
+	health, _ := group.Health(draining)
+	assert.Equal(t, Draining, health)
+
+	for key, owner := range owners {
+		matched, _, err := group.Match(key)
+		assert.Nil(t, err)
+		assert.Equal(t, owner, matched)
+	}
+	for i := 200; i < 400; i++ {
+		matched, _, _ := group.Match(fmt.Sprintf("user-id-%d", i))
+		assert.NotEqual(t, draining, matched)
+	}
+
+	assert.Nil(t, group.Release(pinned[0]))
+	matched, _, _ := group.Match(pinned[0])
+	assert.NotEqual(t, draining, matched)
+	assert.Equal(t, 2, len(group.Elements))
+
+	assert.Nil(t, group.Release(pinned[1:]...))
+	assert.Equal(t, 1, len(group.Elements))
+	assert.Equal(t, []Event{{Type: ElementRemoved, Group: "test", Key: draining, Version: 3}}, drain(events))
+	assert.Equal(t, 0, len(group.StickyKeys(draining)))
+	assert.Equal(t, 0, len(group.health))
+}
+
+func TestGroupDrainWithoutSticky(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", nil)
+	group.Insert("192.168.1.101:1883", nil)
+
+	assert.Nil(t, group.Drain("192.168.1.100:1883"))
+	assert.Equal(t, 1, len(group.Elements))
+	assert.Equal(t, []string{}, group.StickyKeys("192.168.1.101:1883"))
+	assert.Nil(t, group.Release("user-id-1"))
+
+	group.EnableSticky(10)
+	group.DisableSticky()
+	assert.Nil(t, group.sticky)
+}
+
+func TestGroupStickyBounded(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", nil)
+	group.EnableSticky(5)
+	for i := 0; i < 20; i++ {
+		group.Match(fmt.Sprintf("user-id-%d", i))
+	}
+	assert.Equal(t, 5, len(group.StickyKeys("192.168.1.100:1883")))
+	assert.Equal(t, []string{"user-id-15", "user-id-16", "user-id-17", "user-id-18", "user-id-19"}, group.StickyKeys("192.168.1.100:1883"))
+
+	group.Delete("192.168.1.100:1883")
+	assert.Equal(t, 0, len(group.StickyKeys("192.168.1.100:1883")))
+
+	hash := New()
+	removed, _ := hash.CreateGroup("test", 10)
+	hash.RemoveGroup("test")
+	assert.Equal(t, ErrGroupRemoved, removed.EnableSticky(5))
+	assert.Equal(t, ErrGroupRemoved, removed.Drain("a"))
+	assert.Equal(t, ErrGroupRemoved, removed.Release("a"))
+}
+
+func TestGroupStickyFullKeepsDraining(t *testing.T) {
+	group := NewGroup("test", 100)
+	group.Insert("192.168.1.100:1883", nil)
+	group.Insert("192.168.1.101:1883", nil)
+	group.EnableSticky(10)
+
+	draining := "192.168.1.100:1883"
+	for i := 0; i < 100; i++ {
+		group.Match(fmt.Sprintf("user-id-%d", i))
+	}
+	pinned := group.StickyKeys(draining)
+	assert.NotEqual(t, 0, len(pinned))
+	assert.NotEqual(t, 10, len(pinned))
+
+	assert.Nil(t, group.Drain(draining))
+	for i := 100; i < 200; i++ {
+		group.Match(fmt.Sprintf("user-id-%d", i))
+	}
+	assert.Equal(t, pinned, group.StickyKeys(draining))
+	assert.Equal(t, 10-len(pinned), len(group.StickyKeys("192.168.1.101:1883")))
+	for _, key := range pinned {
+		matched, _, _ := group.Match(key)
+		assert.Equal(t, draining, matched)
+	}
+
+	assert.Nil(t, group.SetHealth(draining, Healthy))
+	for i := 200; i < 210; i++ {
+		group.Match(fmt.Sprintf("user-id-%d", i))
+	}
+	for _, key := range pinned {
+		_, ok := group.sticky.get(key)
+		assert.False(t, ok, key)
+	}
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"context"
+	"sync"
+)
+
+// WatchBufferSize is the number of events buffered for each watcher.
+const WatchBufferSize = 128
+
+// EventType is the kind of change an Event reports
+type EventType int
+
+const (
+	// ElementAdded is sent when a new element is inserted into a group.
+	ElementAdded EventType = iota + 1
+
+	// ElementRemoved is sent when an element is deleted from a group.
+	ElementRemoved
+
+	// PayloadUpdated is sent when the payload of an existing element is replaced.
+	PayloadUpdated
+
+	// ReplicasChanged is sent when the number of replicas of a group changes
+	// and its circle is rebuilt.
+	ReplicasChanged
+
+	// GroupCreated is sent when a group is added to a CHash.
+	GroupCreated
+
+	// GroupRemoved is sent when a group is removed from a CHash.
+	GroupRemoved
+
+	// Restored is sent when a group is replaced in place by a snapshot.
+	Restored
+)
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	switch t {
+	case ElementAdded:
+		return "element_added"
+	case ElementRemoved:
+		return "element_removed"
+	case PayloadUpdated:
+		return "payload_updated"
+	case ReplicasChanged:
+		return "replicas_changed"
+	case GroupCreated:
+		return "group_created"
+	case GroupRemoved:
+		return "group_removed"
+	case Restored:
+		return "restored"
+	}
+	return "unknown"
+}
+
+// Event describes a single change of a group or a CHash.
+// Key is only set for element events, Payload only for ElementAdded and PayloadUpdated.
+type Event struct {
+	Type    EventType `json:"type"`
+	Group   string    `json:"group"`
+	Key     string    `json:"key,omitempty"`
+	Payload []byte    `json:"payload,omitempty"`
+
+	// Version increases by one with every change of the source being watched,
+	// a Group or a CHash, so a gap in versions means events were missed.
+	Version uint64 `json:"version"`
+}
+
+// watcher is a single subscription to a hub
+type watcher struct {
+	events chan Event
+	done   chan struct{}
+}
+
+// hub numbers events and fans them out to watchers without ever blocking the publisher
+type hub struct {
+	mu       sync.Mutex
+	version  uint64
+	watchers map[*watcher]struct{}
+}
+
+// current returns the version of the last published event
+func (h *hub) current() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.version
+}
+
+// publish assigns the next version to the event and delivers it to all watchers.
+// A watcher whose buffer is full is closed and dropped.
+func (h *hub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.version++
+	e.Version = h.version
+	for w := range h.watchers {
+		select {
+		case w.events <- e:
+		default:
+			h.drop(w)
+		}
+	}
+}
+
+// drop closes a watcher, the caller must hold the hub lock
+func (h *hub) drop(w *watcher) {
+	if _, ok := h.watchers[w]; !ok {
+		return
+	}
+	delete(h.watchers, w)
+	close(w.events)
+	close(w.done)
+}
+
+// subscribe registers a new watcher that is dropped when ctx is done
+func (h *hub) subscribe(ctx context.Context) <-chan Event {
+	w := &watcher{
+		events: make(chan Event, WatchBufferSize),
+		done:   make(chan struct{}),
+	}
+	h.mu.Lock()
+	if h.watchers == nil {
+		h.watchers = make(map[*watcher]struct{})
+	}
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			h.mu.Lock()
+			h.drop(w)
+			h.mu.Unlock()
+		case <-w.done:
+		}
+	}()
+	return w.events
+}
+
+// closeAll drops every watcher
+func (h *hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		h.drop(w)
+	}
+}
+
+// closedEvents returns a channel that is already closed
+func closedEvents() <-chan Event {
+	ch := make(chan Event)
+	close(ch)
+	return ch
+}
+
+// emit publishes an event of the group to its watchers and to the owning CHash.
+// The caller must hold the group lock.
+func (b *Group) emit(t EventType, key string, payload []byte) {
+	if b.mutations == nil {
+		b.mutations = make(map[EventType]uint64)
+	}
+	b.mutations[t]++
+	e := Event{Type: t, Group: b.Name, Key: key, Payload: payload}
+	b.hub.publish(e)
+	if b.owner != nil {
+		b.owner.publish(e)
+	}
+}
+
+// Watch returns a channel delivering the changes of the group until ctx is done.
+//
+// Events are buffered up to WatchBufferSize. Publishing never blocks the group:
+// if a watcher falls that far behind, its channel is closed and it has to call
+// Watch again and resynchronise, e.g. with GetElements. The channel is also
+// closed after GroupRemoved when the group is removed from its CHash.
+func (b *Group) Watch(ctx context.Context) <-chan Event {
+	b.RLock()
+	defer b.RUnlock()
+	if b.removed {
+		return closedEvents()
+	}
+	return b.hub.subscribe(ctx)
+}
+
+// Version returns the version of the last change of the group
+func (b *Group) Version() uint64 {
+	return b.hub.current()
+}
+
+// Watch returns a channel delivering the changes of all groups of the CHash
+// and the creation and removal of groups until ctx is done.
+// Buffering and slow consumers are handled as described for Group.Watch.
+func (c *CHash) Watch(ctx context.Context) <-chan Event {
+	return c.hub.subscribe(ctx)
+}
+
+// Version returns the version of the last change of the CHash or any of its groups
+func (c *CHash) Version() uint64 {
+	return c.hub.current()
+}
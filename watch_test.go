@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2023 werbenhu
+// SPDX-FileContributor: werbenhu
+
+package chash
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// drain reads all events that are currently buffered in ch
+func drain(ch <-chan Event) []Event {
+	events := make([]Event, 0)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	assert.Equal(t, "element_added", ElementAdded.String())
+	assert.Equal(t, "element_removed", ElementRemoved.String())
+	assert.Equal(t, "payload_updated", PayloadUpdated.String())
+	assert.Equal(t, "replicas_changed", ReplicasChanged.String())
+	assert.Equal(t, "group_created", GroupCreated.String())
+	assert.Equal(t, "group_removed", GroupRemoved.String())
+	assert.Equal(t, "restored", Restored.String())
+	assert.Equal(t, "unknown", EventType(0).String())
+}
+
+func TestGroupWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	group := NewGroup("test", 10)
+	events := group.Watch(ctx)
+
+	group.Insert("192.168.1.100:1883", []byte("werbenhu100"))
+	group.Upsert("192.168.1.100:1883", []byte("werbenhu101"))
+	group.Upsert("192.168.1.101:1883", []byte("werbenhu101"))
+	group.Delete("192.168.1.100:1883")
+	group.Delete("192.168.1.100:1883")
+	group.Insert("192.168.1.101:1883", nil)
+
+	assert.Equal(t, []Event{
+		{Type: ElementAdded, Group: "test", Key: "192.168.1.100:1883", Payload: []byte("werbenhu100"), Version: 1},
+		{Type: PayloadUpdated, Group: "test", Key: "192.168.1.100:1883", Payload: []byte("werbenhu101"), Version: 2},
+		{Type: ElementAdded, Group: "test", Key: "192.168.1.101:1883", Payload: []byte("werbenhu101"), Version: 3},
+		{Type: ElementRemoved, Group: "test", Key: "192.168.1.100:1883", Version: 4},
+	}, drain(events))
+	assert.Equal(t, uint64(4), group.Version())
+
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestGroupWatchSlowConsumer(t *testing.T) {
+	group := NewGroup("test", 1)
+	events := group.Watch(context.Background())
+	for i := 0; i <= WatchBufferSize; i++ {
+		group.Upsert("192.168.1.100:1883", nil)
+	}
+
+	received := drain(events)
+	assert.Equal(t, WatchBufferSize, len(received))
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.Equal(t, uint64(WatchBufferSize+1), group.Version())
+}
+
+func TestCHashWatch(t *testing.T) {
+	hash := New()
+	events := hash.Watch(context.Background())
+
+	group, _ := hash.CreateGroup("werbenhu1", 10)
+	groupEvents := group.Watch(context.Background())
+	hash.Insert("werbenhu1", "192.168.1.101:8080", []byte("werbenhu101"))
+	hash.Restore([]byte(`{"werbenhu1":{"name":"werbenhu1","numberOfReplicas":20},"werbenhu2":{"name":"werbenhu2","numberOfReplicas":10}}`))
+	hash.ApplyConfig(&Config{Groups: []GroupConfig{{Name: "werbenhu1", Replicas: 5}}})
+
+	assert.Equal(t, []Event{
+		{Type: GroupCreated, Group: "werbenhu1", Version: 1},
+		{Type: ElementAdded, Group: "werbenhu1", Key: "192.168.1.101:8080", Payload: []byte("werbenhu101"), Version: 2},
+		{Type: Restored, Group: "werbenhu1", Version: 3},
+		{Type: GroupCreated, Group: "werbenhu2", Version: 4},
+		{Type: ReplicasChanged, Group: "werbenhu1", Version: 5},
+		{Type: GroupRemoved, Group: "werbenhu2", Version: 6},
+	}, drain(events))
+	assert.Equal(t, uint64(6), hash.Version())
+
+	assert.Equal(t, []Event{
+		{Type: ElementAdded, Group: "werbenhu1", Key: "192.168.1.101:8080", Payload: []byte("werbenhu101"), Version: 1},
+		{Type: Restored, Group: "werbenhu1", Version: 2},
+		{Type: ReplicasChanged, Group: "werbenhu1", Version: 3},
+	}, drain(groupEvents))
+
+	hash.RemoveGroup("werbenhu1")
+	assert.Equal(t, []Event{{Type: GroupRemoved, Group: "werbenhu1", Version: 4}}, drain(groupEvents))
+	_, ok := <-groupEvents
+	assert.False(t, ok)
+
+	_, ok = <-group.Watch(context.Background())
+	assert.False(t, ok)
+
+	group.Upsert("192.168.1.101:8080", nil)
+	assert.Equal(t, []Event{{Type: GroupRemoved, Group: "werbenhu1", Version: 7}}, drain(events))
+}